@@ -2,10 +2,13 @@ package main
 
 import (
 	"database/sql"
+	"filmlibrary/migrations"
 	"filmlibrary/pkg/config"
 	"filmlibrary/pkg/explorer"
+	"filmlibrary/pkg/migrate"
 	"log"
 	"net/http"
+	"os"
 
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
@@ -57,6 +60,24 @@ func main() {
 	}
 	logger.Info("Successfully connected to database!")
 
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		logger.Error("failed to load migrations", zap.Error(err))
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(migrator, os.Args[2:], os.Stdout); err != nil {
+			logger.Fatal("migrate failed", zap.Error(err))
+		}
+		return
+	}
+
+	if err := migrator.CheckCurrent(); err != nil {
+		logger.Fatal("refusing to start", zap.Error(err))
+		return
+	}
+
 	serverConfig, err := config.NewServer()
 	if err != nil {
 		logger.Fatal("failed to init server config", zap.Error(err))
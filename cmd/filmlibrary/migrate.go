@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"filmlibrary/pkg/migrate"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const migrateUsage = "usage: filmlibrary migrate up|down|status|goto VERSION|baseline VERSION"
+
+func runMigrate(migrator *migrate.Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up()
+	case "down":
+		return migrator.Down()
+	case "goto", "baseline":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+
+		version, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("bad version %q", args[1])
+		}
+
+		if args[0] == "baseline" {
+			return migrator.Baseline(uint(version))
+		}
+		return migrator.Goto(uint(version))
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%06d %-20s %s\n", status.Version, status.Name, state)
+		}
+
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
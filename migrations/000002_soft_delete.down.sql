@@ -0,0 +1,7 @@
+DROP INDEX actors_deleted_at_idx;
+
+DROP INDEX films_deleted_at_idx;
+
+ALTER TABLE actors DROP COLUMN deleted_at;
+
+ALTER TABLE films DROP COLUMN deleted_at;
\ No newline at end of file
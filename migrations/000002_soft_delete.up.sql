@@ -0,0 +1,7 @@
+ALTER TABLE films ADD COLUMN deleted_at TIMESTAMP DEFAULT NULL;
+
+ALTER TABLE actors ADD COLUMN deleted_at TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX films_deleted_at_idx ON films (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE INDEX actors_deleted_at_idx ON actors (deleted_at) WHERE deleted_at IS NOT NULL;
\ No newline at end of file
@@ -0,0 +1,13 @@
+DROP INDEX films_date_idx;
+
+DROP INDEX films_rating_idx;
+
+DROP INDEX films_name_idx;
+
+DROP INDEX users_username_lower_idx;
+
+DROP INDEX film_actor_actor_id_idx;
+
+ALTER TABLE film_actor
+    DROP CONSTRAINT film_actor_actor_id_fkey,
+    DROP CONSTRAINT film_actor_film_id_fkey;
@@ -0,0 +1,17 @@
+DELETE FROM film_actor
+WHERE film_id NOT IN (SELECT id FROM films)
+OR actor_id NOT IN (SELECT id FROM actors);
+
+ALTER TABLE film_actor
+    ADD CONSTRAINT film_actor_film_id_fkey FOREIGN KEY (film_id) REFERENCES films (id) ON DELETE CASCADE,
+    ADD CONSTRAINT film_actor_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES actors (id) ON DELETE CASCADE;
+
+CREATE INDEX film_actor_actor_id_idx ON film_actor (actor_id);
+
+CREATE UNIQUE INDEX users_username_lower_idx ON users (lower(username));
+
+CREATE INDEX films_name_idx ON films (name, id) WHERE deleted_at IS NULL;
+
+CREATE INDEX films_rating_idx ON films (rating, id) WHERE deleted_at IS NULL;
+
+CREATE INDEX films_date_idx ON films (date, id) WHERE deleted_at IS NULL;
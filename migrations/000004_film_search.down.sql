@@ -0,0 +1,21 @@
+DROP TRIGGER actors_search_update ON actors;
+
+DROP FUNCTION actors_search_update();
+
+DROP TRIGGER film_actor_search_update ON film_actor;
+
+DROP FUNCTION film_actor_search_update();
+
+DROP TRIGGER films_search_update ON films;
+
+DROP FUNCTION films_search_update();
+
+DROP INDEX films_search_idx;
+
+ALTER TABLE films DROP COLUMN search_vector;
+
+DROP FUNCTION film_cast_names(INTEGER);
+
+DROP FUNCTION film_search_query(TEXT);
+
+DROP FUNCTION film_search_vector(TEXT, TEXT, TEXT);
@@ -0,0 +1,70 @@
+-- The russian configuration stems Cyrillic words with the Russian stemmer
+-- and Latin ones with the English stemmer, so it serves both languages.
+CREATE OR REPLACE FUNCTION film_search_vector(name TEXT, description TEXT, cast_names TEXT) RETURNS tsvector
+LANGUAGE SQL IMMUTABLE PARALLEL SAFE AS $$
+    SELECT setweight(to_tsvector('russian', coalesce(name, '')), 'A')
+        || setweight(to_tsvector('russian', coalesce(cast_names, '')), 'B')
+        || setweight(to_tsvector('russian', coalesce(description, '')), 'C')
+$$;
+
+CREATE OR REPLACE FUNCTION film_search_query(query TEXT) RETURNS tsquery
+LANGUAGE SQL IMMUTABLE PARALLEL SAFE AS $$
+    SELECT websearch_to_tsquery('russian', query)
+$$;
+
+CREATE OR REPLACE FUNCTION film_cast_names(film_id INTEGER) RETURNS TEXT
+LANGUAGE SQL STABLE AS $$
+    SELECT string_agg(actors.name, ', ' ORDER BY actors.id)
+    FROM film_actor JOIN actors ON actors.id = film_actor.actor_id
+    WHERE film_actor.film_id = $1 AND actors.deleted_at IS NULL
+$$;
+
+ALTER TABLE films ADD COLUMN search_vector tsvector NOT NULL DEFAULT '';
+
+UPDATE films SET search_vector = film_search_vector(name, description, film_cast_names(id));
+
+CREATE INDEX films_search_idx ON films USING GIN (search_vector) WHERE deleted_at IS NULL;
+
+-- search_vector follows the film, its cast links and the names of its actors.
+CREATE OR REPLACE FUNCTION films_search_update() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+    NEW.search_vector := film_search_vector(NEW.name, NEW.description, film_cast_names(NEW.id));
+    RETURN NEW;
+END
+$$;
+
+CREATE TRIGGER films_search_update BEFORE INSERT OR UPDATE OF name, description ON films
+FOR EACH ROW EXECUTE FUNCTION films_search_update();
+
+CREATE OR REPLACE FUNCTION film_actor_search_update() RETURNS trigger
+LANGUAGE plpgsql AS $$
+DECLARE
+    changed_film_id INTEGER;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed_film_id := OLD.film_id;
+    ELSE
+        changed_film_id := NEW.film_id;
+    END IF;
+
+    UPDATE films SET search_vector = film_search_vector(name, description, film_cast_names(id))
+    WHERE id = changed_film_id;
+    RETURN NULL;
+END
+$$;
+
+CREATE TRIGGER film_actor_search_update AFTER INSERT OR DELETE ON film_actor
+FOR EACH ROW EXECUTE FUNCTION film_actor_search_update();
+
+CREATE OR REPLACE FUNCTION actors_search_update() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE films SET search_vector = film_search_vector(name, description, film_cast_names(id))
+    WHERE id IN (SELECT film_id FROM film_actor WHERE actor_id = NEW.id);
+    RETURN NULL;
+END
+$$;
+
+CREATE TRIGGER actors_search_update AFTER UPDATE OF name, deleted_at ON actors
+FOR EACH ROW EXECUTE FUNCTION actors_search_update();
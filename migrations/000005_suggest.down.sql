@@ -0,0 +1,5 @@
+DROP INDEX actors_name_trgm_idx;
+
+DROP INDEX films_name_trgm_idx;
+
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,5 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX films_name_trgm_idx ON films USING GIN (lower(name) gin_trgm_ops) WHERE deleted_at IS NULL;
+
+CREATE INDEX actors_name_trgm_idx ON actors USING GIN (lower(name) gin_trgm_ops) WHERE deleted_at IS NULL;
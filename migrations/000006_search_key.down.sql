@@ -0,0 +1,7 @@
+DROP INDEX actors_search_key_idx;
+
+DROP INDEX films_search_key_idx;
+
+ALTER TABLE actors DROP COLUMN search_key;
+
+ALTER TABLE films DROP COLUMN search_key;
@@ -0,0 +1,9 @@
+-- search_key holds the transliterated name, see pkg/translit. The application
+-- writes it, and fills it for rows left NULL here when it starts.
+ALTER TABLE films ADD COLUMN search_key TEXT DEFAULT NULL;
+
+ALTER TABLE actors ADD COLUMN search_key TEXT DEFAULT NULL;
+
+CREATE INDEX films_search_key_idx ON films USING GIN (search_key gin_trgm_ops) WHERE deleted_at IS NULL;
+
+CREATE INDEX actors_search_key_idx ON actors USING GIN (search_key gin_trgm_ops) WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE users DROP CONSTRAINT users_role_check;
+
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'user';
+
+UPDATE users SET role = 'user' WHERE role <> 'admin';
@@ -0,0 +1,6 @@
+-- "user" could only read: it becomes viewer
+UPDATE users SET role = 'viewer' WHERE role NOT IN ('viewer', 'editor', 'moderator', 'admin');
+
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'viewer';
+
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('viewer', 'editor', 'moderator', 'admin'));
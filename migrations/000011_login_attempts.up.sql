@@ -0,0 +1,7 @@
+CREATE TABLE login_attempts (
+    key VARCHAR(128) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    blocked_until TIMESTAMPTZ DEFAULT NULL,
+    locked BOOLEAN NOT NULL DEFAULT false
+);
@@ -0,0 +1,121 @@
+package access
+
+import (
+	"filmlibrary/pkg/config"
+	"fmt"
+)
+
+// Role names what a user may do. Roles are ordered: each one holds the
+// permissions of the roles below it.
+type Role string
+
+const (
+	// Guest is the role of requests without a token; it is never stored.
+	Guest     Role = "guest"
+	Viewer    Role = "viewer"
+	Editor    Role = "editor"
+	Moderator Role = "moderator"
+	Admin     Role = "admin"
+)
+
+// roles lists the roles from the least to the most privileged.
+var roles = []Role{Guest, Viewer, Editor, Moderator, Admin}
+
+// Permission is an action on a kind of resource, granted per route.
+type Permission string
+
+const (
+	FilmsRead    Permission = "films.read"
+	FilmsCreate  Permission = "films.create"
+	FilmsUpdate  Permission = "films.update"
+	FilmsDelete  Permission = "films.delete"
+	ActorsRead   Permission = "actors.read"
+	ActorsCreate Permission = "actors.create"
+	ActorsUpdate Permission = "actors.update"
+	ActorsDelete Permission = "actors.delete"
+	TrashRead    Permission = "trash.read"
+	TrashRestore Permission = "trash.restore"
+	TrashPurge   Permission = "trash.purge"
+	// Account covers what users do to their own account and sessions.
+	Account     Permission = "account"
+	UsersManage Permission = "users.manage"
+)
+
+// defaultMatrix maps every permission to the least role holding it.
+var defaultMatrix = map[Permission]Role{
+	FilmsRead:    Guest,
+	FilmsCreate:  Editor,
+	FilmsUpdate:  Editor,
+	FilmsDelete:  Moderator,
+	ActorsRead:   Guest,
+	ActorsCreate: Editor,
+	ActorsUpdate: Editor,
+	ActorsDelete: Moderator,
+	TrashRead:    Moderator,
+	TrashRestore: Moderator,
+	TrashPurge:   Admin,
+	Account:      Viewer,
+	UsersManage:  Admin,
+}
+
+// Policy is the permission matrix in force: the default one with the
+// overrides from config applied.
+type Policy struct {
+	matrix map[Permission]Role
+}
+
+// NewPolicy applies the overrides of cfg to the default matrix. Unknown
+// permissions and roles are errors, so a typo does not silently keep the
+// default.
+func NewPolicy(cfg config.Permissions) (*Policy, error) {
+	matrix := make(map[Permission]Role, len(defaultMatrix))
+	for perm, role := range defaultMatrix {
+		matrix[perm] = role
+	}
+
+	for name, roleName := range cfg.Overrides {
+		perm := Permission(name)
+		if _, ok := matrix[perm]; !ok {
+			return nil, fmt.Errorf("PERMISSIONS: unknown permission %q", name)
+		}
+
+		role := Role(roleName)
+		if rank(role) < 0 {
+			return nil, fmt.Errorf("PERMISSIONS: unknown role %q for %s", roleName, name)
+		}
+		matrix[perm] = role
+	}
+
+	return &Policy{matrix: matrix}, nil
+}
+
+// Allows reports whether role holds perm. Unknown roles hold nothing
+// beyond what guests do.
+func (p *Policy) Allows(role Role, perm Permission) bool {
+	least, ok := p.matrix[perm]
+	if !ok {
+		return false
+	}
+
+	have := rank(role)
+	if have < 0 {
+		have = rank(Guest)
+	}
+
+	return have >= rank(least)
+}
+
+// Valid reports whether role can be stored for a user.
+func Valid(role Role) bool {
+	return role != Guest && rank(role) >= 0
+}
+
+func rank(role Role) int {
+	for i, r := range roles {
+		if r == role {
+			return i
+		}
+	}
+
+	return -1
+}
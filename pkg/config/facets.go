@@ -0,0 +1,25 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+type Facets struct {
+	// TopActors is how many co-occurring actors the actor facet lists.
+	TopActors int `env:"FACETS_TOP_ACTORS" env-default:"10"`
+}
+
+func NewFacets() (*Facets, error) {
+	var cfg Facets
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.TopActors < 1 {
+		return nil, fmt.Errorf("FACETS_TOP_ACTORS must be positive, got %d", cfg.TopActors)
+	}
+
+	return &cfg, nil
+}
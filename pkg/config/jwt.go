@@ -0,0 +1,31 @@
+package config
+
+import (
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+type JWT struct {
+	// Keys lists the keys tokens may be signed with as kid:alg:file, e.g.
+	// "2024b:EdDSA:/keys/2024b.pem,2024a:HS256:/keys/2024a.key". alg is
+	// HS256, RS256 or EdDSA; a PEM file with a public key only verifies.
+	Keys []string `env:"JWT_KEYS" env-separator:","`
+	// PrimaryKID is the key new tokens are signed with, the first one by default.
+	PrimaryKID string `env:"JWT_PRIMARY_KID"`
+	// Secret is an HS256 key given inline rather than in a file, listed after Keys.
+	Secret    string `env:"JWT_SECRET"`
+	SecretKID string `env:"JWT_SECRET_KID" env-default:"default"`
+	// TTL is the lifetime of access tokens, RefreshTTL of refresh tokens.
+	TTL        time.Duration `env:"JWT_TTL" env-default:"15m"`
+	RefreshTTL time.Duration `env:"JWT_REFRESH_TTL" env-default:"720h"`
+}
+
+func NewJWT() (*JWT, error) {
+	var cfg JWT
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
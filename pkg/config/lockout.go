@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+type Lockout struct {
+	// FreeFailures failed logins of a username go without delay, then each
+	// one doubles the wait from Backoff up to MaxBackoff. MaxFailures lock
+	// the username out for Duration. The IP limits work alike.
+	FreeFailures   int           `env:"LOGIN_FREE_FAILURES" env-default:"3"`
+	MaxFailures    int           `env:"LOGIN_MAX_FAILURES" env-default:"10"`
+	FreeFailuresIP int           `env:"LOGIN_FREE_FAILURES_IP" env-default:"20"`
+	MaxFailuresIP  int           `env:"LOGIN_MAX_FAILURES_IP" env-default:"50"`
+	Backoff        time.Duration `env:"LOGIN_BACKOFF" env-default:"1s"`
+	MaxBackoff     time.Duration `env:"LOGIN_MAX_BACKOFF" env-default:"1m"`
+	Duration       time.Duration `env:"LOGIN_LOCKOUT" env-default:"15m"`
+	// Window is how long a failure counts for: a failure after a quiet
+	// Window starts the count over.
+	Window time.Duration `env:"LOGIN_FAILURE_WINDOW" env-default:"1h"`
+}
+
+func NewLockout() (*Lockout, error) {
+	var cfg Lockout
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.FreeFailures < 0 || cfg.MaxFailures <= cfg.FreeFailures {
+		return nil, fmt.Errorf("LOGIN_MAX_FAILURES must exceed LOGIN_FREE_FAILURES, got %d and %d", cfg.MaxFailures, cfg.FreeFailures)
+	}
+	if cfg.FreeFailuresIP < 0 || cfg.MaxFailuresIP <= cfg.FreeFailuresIP {
+		return nil, fmt.Errorf("LOGIN_MAX_FAILURES_IP must exceed LOGIN_FREE_FAILURES_IP, got %d and %d", cfg.MaxFailuresIP, cfg.FreeFailuresIP)
+	}
+	if cfg.Backoff <= 0 || cfg.MaxBackoff < cfg.Backoff || cfg.Duration <= 0 || cfg.Window <= 0 {
+		return nil, fmt.Errorf("login backoff, lockout and window durations must be positive")
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,17 @@
+package config
+
+import "github.com/ilyakaznacheev/cleanenv"
+
+type Pagination struct {
+	DefaultLimit int `env:"PAGE_DEFAULT_LIMIT" env-default:"50"`
+	MaxLimit     int `env:"PAGE_MAX_LIMIT" env-default:"100"`
+}
+
+func NewPagination() (*Pagination, error) {
+	var cfg Pagination
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
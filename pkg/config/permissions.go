@@ -0,0 +1,20 @@
+package config
+
+import (
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+type Permissions struct {
+	// Overrides maps a permission to the least role holding it,
+	// e.g. "trash.read:editor,films.read:viewer".
+	Overrides map[string]string `env:"PERMISSIONS"`
+}
+
+func NewPermissions() (*Permissions, error) {
+	var cfg Permissions
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
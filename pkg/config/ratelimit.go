@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+type RateLimit struct {
+	// Every client may send Requests per Period, in bursts of up to
+	// Requests. Clients are signed in users or, signed out, IPs.
+	Requests int           `env:"RATE_LIMIT_REQUESTS" env-default:"300"`
+	Period   time.Duration `env:"RATE_LIMIT_PERIOD" env-default:"1m"`
+	// Roles maps a role to the requests per Period of its users instead,
+	// e.g. "guest:100,admin:1000".
+	Roles map[string]int `env:"RATE_LIMIT_ROLES"`
+	// Routes maps a route path to the requests per Period a client may
+	// send to it on top of the overall limit, e.g. "/api/films/search:60".
+	Routes map[string]int `env:"RATE_LIMIT_ROUTES" env-default:"/api/films/search:60"`
+}
+
+func NewRateLimit() (*RateLimit, error) {
+	var cfg RateLimit
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Period <= 0 {
+		return nil, fmt.Errorf("RATE_LIMIT_PERIOD must be positive, got %v", cfg.Period)
+	}
+	if cfg.Requests <= 0 {
+		return nil, fmt.Errorf("RATE_LIMIT_REQUESTS must be positive, got %d", cfg.Requests)
+	}
+	for role, requests := range cfg.Roles {
+		if requests <= 0 {
+			return nil, fmt.Errorf("RATE_LIMIT_ROLES: limit of %q must be positive, got %d", role, requests)
+		}
+	}
+	for route, requests := range cfg.Routes {
+		if requests <= 0 {
+			return nil, fmt.Errorf("RATE_LIMIT_ROUTES: limit of %q must be positive, got %d", route, requests)
+		}
+	}
+
+	return &cfg, nil
+}
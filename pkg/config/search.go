@@ -0,0 +1,25 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+type Search struct {
+	// FuzzyThreshold is the lowest trigram similarity, from 0 to 1, a fuzzy hit may have.
+	FuzzyThreshold float64 `env:"SEARCH_FUZZY_THRESHOLD" env-default:"0.4"`
+}
+
+func NewSearch() (*Search, error) {
+	var cfg Search
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.FuzzyThreshold < 0 || cfg.FuzzyThreshold > 1 {
+		return nil, fmt.Errorf("SEARCH_FUZZY_THRESHOLD must be between 0 and 1, got %v", cfg.FuzzyThreshold)
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+type Suggest struct {
+	DefaultLimit int           `env:"SUGGEST_DEFAULT_LIMIT" env-default:"8"`
+	MaxLimit     int           `env:"SUGGEST_MAX_LIMIT" env-default:"20"`
+	Timeout      time.Duration `env:"SUGGEST_TIMEOUT" env-default:"150ms"`
+}
+
+func NewSuggest() (*Suggest, error) {
+	var cfg Suggest
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+type Trash struct {
+	Retention time.Duration `env:"TRASH_RETENTION" env-default:"720h"`
+}
+
+func NewTrash() (*Trash, error) {
+	var cfg Trash
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
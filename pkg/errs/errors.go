@@ -2,12 +2,15 @@ package errs
 
 type ErrorResponse struct {
 	Errors []ErrorDetail `json:"errors"`
-	Status int
+	Status int           `json:"status"`
 }
 
+// ErrorDetail describes what is wrong with a request parameter. Pos is the
+// 1-based position of the error inside the parameter value, if known.
 type ErrorDetail struct {
 	Param string `json:"param"`
 	Msg   string `json:"msg"`
+	Pos   int    `json:"pos,omitempty"`
 }
 
 const (
@@ -32,4 +35,25 @@ const (
 	WrongColumnError    = "wrong column name"
 	EmptyUsernameError  = "empty username"
 	HashPasswordError   = "failed to hash password"
+	ReadingAgeError     = "incorrect older_than"
+	DuplicateCastError  = "actor already in film cast"
+	ReadingLimitError   = "incorrect limit"
+	ReadingCursorError  = "incorrect cursor"
+	ActorNotExist       = "actor not exist"
+	FilmNotExist        = "film not exist"
+	FilmDateError       = "incorrect film date"
+	FilmRatingError     = "incorrect film rating"
+	ReadingFilterError  = "incorrect filter"
+	SuggestTimeoutError = "suggestions took too long"
+	ReadingModeError    = "incorrect mode"
+	ReadingFacetsError  = "incorrect facets"
+	InvalidRefreshToken = "invalid refresh token"
+	RefreshTokenReused  = "refresh token reused"
+	TokenRevoked        = "token revoked"
+	SessionNotExist     = "session not exist"
+	UserDisabled        = "user disabled"
+	ReadingRoleError    = "incorrect role"
+	OwnAccountError     = "cannot manage own account"
+	TooManyAttempts     = "too many login attempts"
+	TooManyRequests     = "too many requests"
 )
@@ -3,9 +3,14 @@ package explorer
 import (
 	"database/sql"
 	_ "filmlibrary/docs"
+	"filmlibrary/pkg/access"
+	"filmlibrary/pkg/config"
 	"filmlibrary/pkg/handlers"
 	"filmlibrary/pkg/items"
+	"filmlibrary/pkg/lockout"
 	"filmlibrary/pkg/middleware"
+	"filmlibrary/pkg/ratelimit"
+	"filmlibrary/pkg/session"
 	"filmlibrary/pkg/users"
 	"net/http"
 
@@ -18,34 +23,146 @@ import (
 
 func NewExplorer(db *sql.DB, logger *zap.SugaredLogger) (http.Handler, error) {
 	itemRepo := items.NewMemoryRepo(db)
-	userRepo := users.NewMemoryRepo(db)
+
+	filled, err := itemRepo.FillSearchKeys()
+	if err != nil {
+		return nil, err
+	}
+	if filled > 0 {
+		logger.Infow("filled search keys", "rows", filled)
+	}
+
+	return NewRepoExplorer(itemRepo, users.NewMemoryRepo(db), logger)
+}
+
+// NewRepoExplorer builds the HTTP stack on top of any storage implementation.
+func NewRepoExplorer(itemRepo items.ItemRepo, userRepo users.UserRepo, logger *zap.SugaredLogger) (http.Handler, error) {
+	trashConfig, err := config.NewTrash()
+	if err != nil {
+		return nil, err
+	}
+
+	pageConfig, err := config.NewPagination()
+	if err != nil {
+		return nil, err
+	}
+
+	searchConfig, err := config.NewSearch()
+	if err != nil {
+		return nil, err
+	}
+
+	suggestConfig, err := config.NewSuggest()
+	if err != nil {
+		return nil, err
+	}
+
+	facetsConfig, err := config.NewFacets()
+	if err != nil {
+		return nil, err
+	}
+
+	jwtConfig, err := config.NewJWT()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := session.LoadKeys(*jwtConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	permissionsConfig, err := config.NewPermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := access.NewPolicy(*permissionsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutConfig, err := config.NewLockout()
+	if err != nil {
+		return nil, err
+	}
+	guard := lockout.NewGuard(userRepo, *lockoutConfig, logger)
+
+	rateLimitConfig, err := config.NewRateLimit()
+	if err != nil {
+		return nil, err
+	}
+	limiter, err := ratelimit.NewLimiter(*rateLimitConfig)
+	if err != nil {
+		return nil, err
+	}
 
 	actorHandler := &handlers.ActorsHandler{
 		ActorsRepo: itemRepo,
+		Limits:     *pageConfig,
 		Logger:     logger,
 	}
 	filmHandler := &handlers.FilmsHandler{
 		FilmsRepo: itemRepo,
+		Limits:    *pageConfig,
+		Search:    *searchConfig,
+		Facets:    *facetsConfig,
+		Logger:    logger,
+	}
+	trashHandler := &handlers.TrashHandler{
+		ItemsRepo: itemRepo,
+		Retention: trashConfig.Retention,
+		Logger:    logger,
+	}
+	suggestHandler := &handlers.SuggestHandler{
+		ItemsRepo: itemRepo,
+		Config:    *suggestConfig,
 		Logger:    logger,
 	}
 	userHandler := &handlers.UsersHandler{
 		UserRepo: userRepo,
+		Keys:     keys,
+		Guard:    guard,
+		Logger:   logger,
+	}
+	sessionHandler := &handlers.SessionsHandler{
+		UserRepo: userRepo,
+		Logger:   logger,
+	}
+	accountHandler := &handlers.AccountsHandler{
+		UserRepo: userRepo,
+		Limits:   *pageConfig,
+		Guard:    guard,
 		Logger:   logger,
 	}
 
 	router := mux.NewRouter()
+	// can wraps a handler with the permission its route requires.
+	can := func(perm access.Permission, handler http.HandlerFunc) http.Handler {
+		return middleware.Authorize(logger, policy, perm, handler)
+	}
+
+	router.Handle("/api/actors", can(access.ActorsCreate, actorHandler.CreateActor)).Methods("POST")
+	router.Handle("/api/actors", can(access.ActorsRead, actorHandler.GetActors)).Methods("GET")
+	router.Handle("/api/actors/search", can(access.ActorsRead, actorHandler.SearchActors)).Methods("GET")
+	router.Handle("/api/actors/{ACTOR_ID}", can(access.ActorsRead, actorHandler.GetActor)).Methods("GET")
+	router.Handle("/api/actors/{ACTOR_ID}", can(access.ActorsUpdate, actorHandler.UpdateActor)).Methods("POST")
+	router.Handle("/api/actors/{ACTOR_ID}", can(access.ActorsDelete, actorHandler.DeleteActor)).Methods("DELETE")
+	router.Handle("/api/actors/{ACTOR_ID}/{COLUMN_NAME}", can(access.ActorsUpdate, actorHandler.UpdateColumnActor)).Methods("POST")
 
-	router.HandleFunc("/api/actors", actorHandler.CreateActor).Methods("POST")
-	router.HandleFunc("/api/actors", actorHandler.GetActors).Methods("GET")
-	router.HandleFunc("/api/actors/{ACTOR_ID}", actorHandler.GetActor).Methods("GET")
-	router.HandleFunc("/api/actors/{ACTOR_ID}", actorHandler.UpdateActor).Methods("POST")
-	router.HandleFunc("/api/actors/{ACTOR_ID}/{COLUMN_NAME}", actorHandler.UpdateColumnActor).Methods("POST")
+	router.Handle("/api/films/search", can(access.FilmsRead, filmHandler.SearchFilm)).Methods("GET")
+	router.Handle("/api/films", can(access.FilmsRead, filmHandler.GetFilms)).Methods("GET")
+	router.Handle("/api/films", can(access.FilmsCreate, filmHandler.CreateFilm)).Methods("POST")
+	router.Handle("/api/films/{FILM_ID}", can(access.FilmsUpdate, filmHandler.UpdateFilm)).Methods("POST")
+	router.Handle("/api/films/{FILM_ID}", can(access.FilmsDelete, filmHandler.DeleteFilm)).Methods("DELETE")
+	router.Handle("/api/films/{FILM_ID}/{COLUMN_NAME}", can(access.FilmsUpdate, filmHandler.UpdateColumnFilm)).Methods("POST")
 
-	router.HandleFunc("/api/films/search", filmHandler.SearchFilm).Methods("GET")
-	router.HandleFunc("/api/films", filmHandler.GetFilms).Methods("GET")
-	router.HandleFunc("/api/films", filmHandler.CreateFilm).Methods("POST")
-	router.HandleFunc("/api/films/{FILM_ID}", filmHandler.UpdateFilm).Methods("POST")
-	router.HandleFunc("/api/films/{FILM_ID}/{COLUMN_NAME}", filmHandler.UpdateColumnFilm).Methods("POST")
+	router.Handle("/api/suggest", can(access.FilmsRead, suggestHandler.Suggest)).Methods("GET")
+
+	router.Handle("/api/trash", can(access.TrashRead, trashHandler.GetTrash)).Methods("GET")
+	router.Handle("/api/trash", can(access.TrashPurge, trashHandler.PurgeTrash)).Methods("DELETE")
+	router.Handle("/api/trash/films/{FILM_ID}/restore", can(access.TrashRestore, trashHandler.RestoreFilm)).Methods("POST")
+	router.Handle("/api/trash/actors/{ACTOR_ID}/restore", can(access.TrashRestore, trashHandler.RestoreActor)).Methods("POST")
 
 	router.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"), // Путь к вашему файлу swagger.json
@@ -53,8 +170,26 @@ func NewExplorer(db *sql.DB, logger *zap.SugaredLogger) (http.Handler, error) {
 
 	router.HandleFunc("/api/login", userHandler.Login).Methods("POST")
 	router.HandleFunc("/api/register", userHandler.Register).Methods("POST")
+	router.HandleFunc("/api/token/refresh", userHandler.Refresh).Methods("POST")
+	router.Handle("/api/logout", can(access.Account, userHandler.Logout)).Methods("POST")
+
+	router.Handle("/api/me", can(access.Account, userHandler.GetMe)).Methods("GET")
+	router.Handle("/api/me", can(access.Account, userHandler.DeleteMe)).Methods("DELETE")
+	router.Handle("/api/me/password", can(access.Account, userHandler.ChangePassword)).Methods("POST")
+	router.Handle("/api/me/sessions", can(access.Account, sessionHandler.GetSessions)).Methods("GET")
+	router.Handle("/api/me/sessions/{SESSION_ID}", can(access.Account, sessionHandler.RevokeSession)).Methods("DELETE")
+	router.Handle("/api/users", can(access.UsersManage, accountHandler.GetUsers)).Methods("GET")
+	router.Handle("/api/users/{USER_ID}", can(access.UsersManage, accountHandler.GetUser)).Methods("GET")
+	router.Handle("/api/users/{USER_ID}", can(access.UsersManage, accountHandler.DeleteUser)).Methods("DELETE")
+	router.Handle("/api/users/{USER_ID}/role", can(access.UsersManage, accountHandler.SetRole)).Methods("POST")
+	router.Handle("/api/users/{USER_ID}/disable", can(access.UsersManage, accountHandler.DisableUser)).Methods("POST")
+	router.Handle("/api/users/{USER_ID}/enable", can(access.UsersManage, accountHandler.EnableUser)).Methods("POST")
+	router.Handle("/api/users/{USER_ID}/unlock", can(access.UsersManage, accountHandler.UnlockUser)).Methods("POST")
+	router.Handle("/api/users/{USER_ID}/sessions", can(access.UsersManage, sessionHandler.RevokeUserSessions)).Methods("DELETE")
 
-	myMux := middleware.Auth(logger, router, userRepo)
+	// Auth runs first to put the user the limiter counts in the context
+	myMux := middleware.RateLimit(logger, limiter, router)
+	myMux = middleware.Auth(logger, myMux, userRepo, keys)
 	myMux = middleware.AccessLog(logger, myMux)
 	myMux = middleware.Panic(logger, myMux)
 
@@ -0,0 +1,82 @@
+package filmql
+
+// Node is an element of a parsed query: And, Or, Not, Match or Text.
+type Node interface {
+	node()
+}
+
+// And matches films matching every one of Nodes.
+type And struct {
+	Nodes []Node
+}
+
+// Or matches films matching any of Nodes.
+type Or struct {
+	Nodes []Node
+}
+
+// Not matches films Node does not match, including those where the field
+// it compares is empty.
+type Not struct {
+	Node Node
+}
+
+// Match compares a film field with a value. Text fields hold the value in
+// Text, number fields in Number.
+type Match struct {
+	Field  Field
+	Op     Op
+	Text   string
+	Number int64
+}
+
+// Text is a free text term, searched like a full-text search query.
+type Text struct {
+	Text string
+}
+
+func (And) node()   {}
+func (Or) node()    {}
+func (Not) node()   {}
+func (Match) node() {}
+func (Text) node()  {}
+
+// Field is a film field a query can compare.
+type Field string
+
+const (
+	FieldTitle       Field = "title"
+	FieldDescription Field = "description"
+	FieldActor       Field = "actor"
+	FieldYear        Field = "year"
+	FieldRating      Field = "rating"
+)
+
+// fields maps the field names of the syntax, aliases included, to fields.
+var fields = map[string]Field{
+	"title":       FieldTitle,
+	"name":        FieldTitle,
+	"description": FieldDescription,
+	"actor":       FieldActor,
+	"year":        FieldYear,
+	"date":        FieldYear,
+	"rating":      FieldRating,
+}
+
+// Numeric reports whether the field holds numbers rather than text.
+func (f Field) Numeric() bool {
+	return f == FieldYear || f == FieldRating
+}
+
+// Op is the comparison of a Match. Text fields support OpContains and
+// OpEqual, number fields every Op but OpContains: year:2000 is OpEqual.
+type Op string
+
+const (
+	OpContains     Op = ":"
+	OpEqual        Op = "="
+	OpGreater      Op = ">"
+	OpGreaterEqual Op = ">="
+	OpLess         Op = "<"
+	OpLessEqual    Op = "<="
+)
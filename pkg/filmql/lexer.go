@@ -0,0 +1,109 @@
+package filmql
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenColon
+	tokenCompare
+	tokenMinus
+	tokenLParen
+	tokenRParen
+)
+
+// token is a lexeme of the query. Pos is the 1-based position of its first
+// character, counted in characters rather than bytes.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+
+	return `"` + t.text + `"`
+}
+
+// special runes end a word.
+const special = `:()"<>=`
+
+func lex(query string) ([]token, error) {
+	runes := []rune(query)
+
+	var tokens []token
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenLParen, "(", pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRParen, ")", pos})
+			i++
+		case r == ':':
+			tokens = append(tokens, token{tokenColon, ":", pos})
+			i++
+		case r == '<' || r == '>' || r == '=':
+			op := string(r)
+			if r != '=' && i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			tokens = append(tokens, token{tokenCompare, op, pos})
+			i += len(op)
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && startsTerm(tokens):
+			tokens = append(tokens, token{tokenMinus, "-", pos})
+			i++
+		case r == '"':
+			var text strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				text.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, &Error{Pos: pos, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{tokenString, text.String(), pos})
+			i++
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(special, runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, string(runes[start:i]), pos})
+		}
+	}
+
+	return append(tokens, token{tokenEOF, "", len(runes) + 1}), nil
+}
+
+// startsTerm reports whether the next token begins a new term, so that a
+// minus there negates it instead of being part of a word like "spider-man".
+func startsTerm(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+
+	switch tokens[len(tokens)-1].kind {
+	case tokenColon, tokenCompare:
+		return false
+	default:
+		return true
+	}
+}
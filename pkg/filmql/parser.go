@@ -0,0 +1,209 @@
+// Package filmql parses the film search language, e.g.
+//
+//	actor:"Tom Hanks" year:>=2000 rating:>7 -title:sequel
+//
+// Terms are field:value comparisons or free text. Terms next to each other
+// must all match; OR, parentheses and a leading minus or NOT combine them
+// otherwise. Parse validates the fields and values, and SQL compiles the
+// result to a parameterized condition on the films table.
+package filmql
+
+import (
+	"filmlibrary/pkg/errs"
+	"fmt"
+	"strconv"
+)
+
+// Error is a query that does not parse. Pos is the 1-based position of the
+// offending token, counted in characters.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// Detail describes the error for the API, with param the name of the
+// request parameter holding the query.
+func (e *Error) Detail(param string) errs.ErrorDetail {
+	return errs.ErrorDetail{Param: param, Msg: e.Msg, Pos: e.Pos}
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+// Parse turns query into a syntax tree. The error is an *Error.
+func Parse(query string) (Node, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, &Error{Pos: p.peek().pos, Msg: "empty query"}
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, unexpected(tok)
+	}
+
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokenEOF {
+		p.next++
+	}
+	return tok
+}
+
+func (p *parser) keyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokenWord && tok.text == word
+}
+
+func (p *parser) parseOr() (Node, error) {
+	var nodes []Node
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		if !p.keyword("OR") {
+			break
+		}
+		p.take()
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	var nodes []Node
+	for {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		if p.keyword("AND") {
+			p.take()
+			continue
+		}
+		if tok := p.peek(); tok.kind == tokenEOF || tok.kind == tokenRParen || p.keyword("OR") {
+			break
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return And{Nodes: nodes}, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().kind == tokenMinus || p.keyword("NOT") {
+		p.take()
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: node}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	tok := p.take()
+
+	switch tok.kind {
+	case tokenLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); closing.kind != tokenRParen {
+			return nil, &Error{Pos: closing.pos, Msg: fmt.Sprintf("expected \")\", got %s", closing)}
+		}
+		return node, nil
+	case tokenString:
+		if tok.text == "" {
+			return nil, &Error{Pos: tok.pos, Msg: "empty string"}
+		}
+		return Text{Text: tok.text}, nil
+	case tokenWord:
+		if tok.text == "AND" || tok.text == "OR" {
+			return nil, unexpected(tok)
+		}
+		if p.peek().kind != tokenColon {
+			return Text{Text: tok.text}, nil
+		}
+		p.take()
+		return p.parseMatch(tok)
+	default:
+		return nil, unexpected(tok)
+	}
+}
+
+// parseMatch parses the comparison following "field:".
+func (p *parser) parseMatch(name token) (Node, error) {
+	field, ok := fields[name.text]
+	if !ok {
+		return nil, &Error{Pos: name.pos, Msg: fmt.Sprintf("unknown field %s", name)}
+	}
+
+	op := OpContains
+	if tok := p.peek(); tok.kind == tokenCompare {
+		p.take()
+		op = Op(tok.text)
+		if !field.Numeric() && op != OpEqual {
+			return nil, &Error{Pos: tok.pos, Msg: fmt.Sprintf("%s does not support %s", field, tok)}
+		}
+	}
+	if field.Numeric() && op == OpContains {
+		op = OpEqual
+	}
+
+	value := p.take()
+	if (value.kind != tokenWord && value.kind != tokenString) || value.text == "" {
+		return nil, &Error{Pos: value.pos, Msg: fmt.Sprintf("expected %s value, got %s", field, value)}
+	}
+
+	match := Match{Field: field, Op: op, Text: value.text}
+	if field.Numeric() {
+		number, err := strconv.ParseInt(value.text, 10, 64)
+		if err != nil {
+			return nil, &Error{Pos: value.pos, Msg: fmt.Sprintf("%s must be a whole number, got %s", field, value)}
+		}
+		match = Match{Field: field, Op: op, Number: number}
+	}
+
+	return match, nil
+}
+
+func unexpected(tok token) error {
+	return &Error{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %s", tok)}
+}
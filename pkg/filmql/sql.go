@@ -0,0 +1,76 @@
+package filmql
+
+import (
+	"filmlibrary/pkg/like"
+	"fmt"
+	"strings"
+)
+
+// columns are the films table columns of the fields compared in place.
+var columns = map[Field]string{
+	FieldTitle:       "name",
+	FieldDescription: "description",
+	FieldYear:        "date",
+	FieldRating:      "rating",
+}
+
+// SQL compiles node to a condition on the films table. Values are passed
+// as args behind ? placeholders and never end up in the SQL text.
+func SQL(node Node) (string, []interface{}) {
+	var args []interface{}
+	condition := compile(node, &args)
+	return condition, args
+}
+
+func compile(node Node, args *[]interface{}) string {
+	switch node := node.(type) {
+	case And:
+		return join(node.Nodes, " AND ", args)
+	case Or:
+		return join(node.Nodes, " OR ", args)
+	case Not:
+		// IS NOT TRUE keeps films whose compared field is NULL
+		return fmt.Sprintf("(%s) IS NOT TRUE", compile(node.Node, args))
+	case Text:
+		*args = append(*args, node.Text)
+		return "search_vector @@ film_search_query(?)"
+	case Match:
+		return compileMatch(node, args)
+	default:
+		panic(fmt.Sprintf("filmql: unexpected node %T", node))
+	}
+}
+
+func join(nodes []Node, sep string, args *[]interface{}) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = compile(node, args)
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+func compileMatch(match Match, args *[]interface{}) string {
+	if match.Field.Numeric() {
+		*args = append(*args, match.Number)
+		return fmt.Sprintf("%s %s ?", columns[match.Field], match.Op)
+	}
+
+	column := columns[match.Field]
+	if match.Field == FieldActor {
+		column = "actors.name"
+	}
+
+	condition := fmt.Sprintf(`%s ILIKE ? ESCAPE '\'`, column)
+	value := "%" + like.Escape(match.Text) + "%"
+	if match.Op == OpEqual {
+		condition = fmt.Sprintf("lower(%s) = lower(?)", column)
+		value = match.Text
+	}
+	*args = append(*args, value)
+
+	if match.Field == FieldActor {
+		return `id IN (SELECT film_actor.film_id FROM film_actor JOIN actors ON actors.id = film_actor.actor_id
+            WHERE actors.deleted_at IS NULL AND ` + condition + ")"
+	}
+	return condition
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"filmlibrary/pkg/access"
+	"filmlibrary/pkg/config"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/lockout"
+	"filmlibrary/pkg/users"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type AccountsHandler struct {
+	UserRepo users.UserRepo
+	Limits   config.Pagination
+	Guard    *lockout.Guard
+	Logger   *zap.SugaredLogger
+}
+
+type RoleData struct {
+	Role string `json:"role"`
+}
+
+// @Summary Get users
+// @Description list accounts, ordered by id
+// @Security ApiKeyAuth
+// @Tags admin
+// @Produce json
+// @Param search query string false "part of the username"
+// @Param role query string false "role" Enums(viewer, editor, moderator, admin)
+// @Param limit query int false "page size"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/users [get]
+func (h *AccountsHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	page, limit, err := parsePage(r, h.Limits, fieldID, orderAsc)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	filter := users.UserFilter{
+		Search: r.URL.Query().Get("search"),
+		Role:   r.URL.Query().Get("role"),
+		Limit:  page.Limit,
+	}
+	if filter.Role != "" && !access.Valid(access.Role(filter.Role)) {
+		writeError(h.Logger, w, http.StatusBadRequest, errors.New(errs.ReadingRoleError))
+		return
+	}
+	if page.After != nil {
+		filter.AfterID = page.After.ID
+	}
+
+	accounts, total, err := h.UserRepo.ListUsers(filter)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var next string
+	if len(accounts) > limit {
+		accounts = accounts[:limit]
+		next = encodeCursor(fieldID, orderAsc, accounts[limit-1].ID, nil)
+	}
+
+	writePage(h.Logger, w, r, accounts, next, limit, total, nil)
+}
+
+// @Summary Get user
+// @Description Get account by id
+// @Security ApiKeyAuth
+// @Tags admin
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/users/{id} [get]
+func (h *AccountsHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["USER_ID"], 10, 32)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := h.UserRepo.GetUserByID(uint32(id))
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, user.Account())
+}
+
+// @Summary Change user role
+// @Description give a user another role; admins cannot change their own
+// @Security ApiKeyAuth
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "user id"
+// @Param role body RoleData true "new role"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 409 {object} ErrorResponse
+// @Failed 422 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/users/{id}/role [post]
+func (h *AccountsHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.parseOtherUser(w, r)
+	if !ok {
+		return
+	}
+
+	var data RoleData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, errors.New(errs.JSONerror))
+		return
+	}
+	if !access.Valid(access.Role(data.Role)) {
+		writeError(h.Logger, w, http.StatusUnprocessableEntity, errors.New(errs.ReadingRoleError))
+		return
+	}
+
+	if err := h.UserRepo.SetUserRole(id, data.Role); err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+
+	h.writeAccount(w, id)
+	h.Logger.Infof("user %v is now %v", id, data.Role)
+}
+
+// @Summary Disable user
+// @Description forbid a user to log in and end their sessions
+// @Security ApiKeyAuth
+// @Tags admin
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 409 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/users/{id}/disable [post]
+func (h *AccountsHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+// @Summary Enable user
+// @Description let a disabled user log in again
+// @Security ApiKeyAuth
+// @Tags admin
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 409 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/users/{id}/enable [post]
+func (h *AccountsHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+// @Summary Unlock user
+// @Description lift the lockout and backoff put on logins of a user after failed attempts
+// @Security ApiKeyAuth
+// @Tags admin
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/users/{id}/unlock [post]
+func (h *AccountsHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["USER_ID"], 10, 32)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := h.UserRepo.GetUserByID(uint32(id))
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+
+	if err := h.Guard.Unlock(user.Login); err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var by uint32
+	if admin, ok := users.UserFromContext(r.Context()); ok {
+		by = admin.ID
+	}
+	h.Logger.Infow("audit: login unlocked",
+		"user", user.ID,
+		"by", by,
+	)
+
+	writeResponse(h.Logger, w, http.StatusOK, user.Account())
+}
+
+// @Summary Delete user
+// @Description delete an account with its sessions
+// @Security ApiKeyAuth
+// @Tags admin
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 409 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/users/{id} [delete]
+func (h *AccountsHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.parseOtherUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.UserRepo.GetUserByID(id)
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+
+	if err := h.UserRepo.DeleteUser(id); err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+
+	// whoever registers the name next must not inherit its lockout
+	if err := h.Guard.Unlock(user.Login); err != nil {
+		h.Logger.Errorf("clearing failed logins: %v", err)
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, id)
+	h.Logger.Infof("deleted user %v", id)
+}
+
+func (h *AccountsHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, ok := h.parseOtherUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.UserRepo.SetUserDisabled(id, disabled, time.Now()); err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+
+	h.writeAccount(w, id)
+	h.Logger.Infof("user %v disabled: %v", id, disabled)
+}
+
+// parseOtherUser reads the user ID of the route. Admins cannot lock
+// themselves out, so their own ID is refused.
+func (h *AccountsHandler) parseOtherUser(w http.ResponseWriter, r *http.Request) (uint32, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["USER_ID"], 10, 32)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return 0, false
+	}
+
+	if u, ok := users.UserFromContext(r.Context()); ok && u.ID == uint32(id) {
+		writeError(h.Logger, w, http.StatusConflict, errors.New(errs.OwnAccountError))
+		return 0, false
+	}
+
+	return uint32(id), true
+}
+
+func (h *AccountsHandler) writeAccount(w http.ResponseWriter, id uint32) {
+	user, err := h.UserRepo.GetUserByID(id)
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, user.Account())
+}
+
+func (h *AccountsHandler) writeAccountError(w http.ResponseWriter, err error) {
+	if err.Error() == errs.UserNotExist {
+		writeError(h.Logger, w, http.StatusNotFound, err)
+		return
+	}
+	writeError(h.Logger, w, http.StatusInternalServerError, err)
+}
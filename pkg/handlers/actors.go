@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"filmlibrary/pkg/config"
 	"filmlibrary/pkg/errs"
 	"filmlibrary/pkg/items"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 type ActorsHandler struct {
 	Tmpl       *template.Template
 	ActorsRepo items.ItemRepo
+	Limits     config.Pagination
 	Logger     *zap.SugaredLogger
 }
 
@@ -55,12 +57,54 @@ func (h *ActorsHandler) CreateActor(w http.ResponseWriter, r *http.Request) {
 // @Description Get actor list
 // @Tags actors
 // @Produce json
+// @Param limit query int false "page size"
+// @Param cursor query string false "next_cursor of the previous page"
 // @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
 // @Failed 500 {object} ErrorResponse
 // @Router /api/actors [get]
 func (h *ActorsHandler) GetActors(w http.ResponseWriter, r *http.Request) {
+	page, limit, err := parsePage(r, h.Limits, fieldID, orderAsc)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	actors, total, err := h.ActorsRepo.GetActors(page)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var next string
+	if len(actors) > limit {
+		actors = actors[:limit]
+		next = encodeCursor(fieldID, orderAsc, actors[limit-1].ID, nil)
+	}
+
+	writePage(h.Logger, w, r, actors, next, limit, total, nil)
+}
+
+// @Summary Search actors
+// @Description find actors by a part of the name, with the number of films of each
+// @Tags actors
+// @Produce json
+// @Param name query string true "part of the actor name"
+// @Param gender query string false "gender"
+// @Param born_from query string false "earliest birth date, YYYY-MM-DD"
+// @Param born_to query string false "latest birth date, YYYY-MM-DD"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/actors/search [get]
+func (h *ActorsHandler) SearchActors(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseActorFilter(r)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
 
-	actors, err := h.ActorsRepo.GetActors()
+	actors, err := h.ActorsRepo.SearchActors(filter)
 	if err != nil {
 		writeError(h.Logger, w, http.StatusInternalServerError, err)
 		return
@@ -191,3 +235,36 @@ func (h *ActorsHandler) UpdateColumnActor(w http.ResponseWriter, r *http.Request
 
 	writeResponse(h.Logger, w, http.StatusOK, actor)
 }
+
+// @Summary Delete actor
+// @Description Delete actor and remove him from film casts
+// @Security ApiKeyAuth
+// @Tags actors
+// @Produce json
+// @Param  id path int true "actor id"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/actors/{id} [delete]
+func (h *ActorsHandler) DeleteActor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id, err := strconv.ParseUint(vars["ACTOR_ID"], 10, 32)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.ActorsRepo.DeleteActor(uint32(id))
+	if err != nil {
+		if err.Error() == errs.NotFound {
+			writeError(h.Logger, w, http.StatusNotFound, err)
+			return
+		}
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, uint32(id))
+}
@@ -3,7 +3,9 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"filmlibrary/pkg/config"
 	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/filmql"
 	"filmlibrary/pkg/items"
 	"net/http"
 	"reflect"
@@ -18,9 +20,18 @@ import (
 type FilmsHandler struct {
 	Tmpl      *template.Template
 	FilmsRepo items.ItemRepo
+	Limits    config.Pagination
+	Search    config.Search
+	Facets    config.Facets
 	Logger    *zap.SugaredLogger
 }
 
+const (
+	searchModeFullText = "fulltext"
+	searchModeFuzzy    = "fuzzy"
+	searchModeQuery    = "query"
+)
+
 // @Summary Create film
 // @Description Create new film
 // @Security ApiKeyAuth
@@ -30,6 +41,8 @@ type FilmsHandler struct {
 // @Param  actor body films.Film true "film data"
 // @Success 201 {object} Response
 // @Failed 400 {object} ErrorResponse
+// @Failed 409 {object} ErrorResponse
+// @Failed 422 {object} ErrorResponse
 // @Failed 500 {object} ErrorResponse
 // @Router /api/films [post]
 func (h *FilmsHandler) CreateFilm(w http.ResponseWriter, r *http.Request) {
@@ -44,7 +57,7 @@ func (h *FilmsHandler) CreateFilm(w http.ResponseWriter, r *http.Request) {
 
 	film.ID, err = h.FilmsRepo.CreateFilm(film)
 	if err != nil {
-		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		writeError(h.Logger, w, writeStatus(err), err)
 		return
 	}
 
@@ -52,11 +65,21 @@ func (h *FilmsHandler) CreateFilm(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Get films
-// @Description get films sorted by parameters
+// @Description get films sorted and filtered by parameters
 // @Tags films
 // @Produce json
 // @Param field query string false "sorting field"
 // @Param order query int false "desc or asc"
+// @Param date_from query int false "earliest release year"
+// @Param date_to query int false "latest release year"
+// @Param rating_from query int false "lowest rating"
+// @Param rating_to query int false "highest rating"
+// @Param actor query []int false "film has this actor id, repeatable" collectionFormat(multi)
+// @Param actor_match query string false "all or any of the actors, all by default" Enums(all, any)
+// @Param name_prefix query string false "name starts with, case insensitive"
+// @Param limit query int false "page size"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param facets query bool false "also count the matching films per decade, rating bucket and top actor"
 // @Success 200 {object} Response
 // @Failed 400 {object} ErrorResponse
 // @Failed 500 {object} ErrorResponse
@@ -68,20 +91,57 @@ func (h *FilmsHandler) GetFilms(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	films, err := h.FilmsRepo.GetFilms(field, order)
+	filter, err := parseFilmFilter(r)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, limit, err := parsePage(r, h.Limits, field, order)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	withFacets, err := parseFacets(r)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	films, total, err := h.FilmsRepo.GetFilms(field, order, filter, page)
 	if err != nil {
 		writeError(h.Logger, w, http.StatusInternalServerError, err)
 		return
 	}
 
-	writeResponse(h.Logger, w, http.StatusOK, films)
+	var facets *items.Facets
+	if withFacets {
+		counted, err := h.FilmsRepo.FilmFacets(filter, h.Facets.TopActors)
+		if err != nil {
+			writeError(h.Logger, w, http.StatusInternalServerError, err)
+			return
+		}
+		facets = &counted
+	}
+
+	var next string
+	if len(films) > limit {
+		films = films[:limit]
+		last := films[limit-1]
+		next = encodeCursor(field, order, last.ID, filmSortValue(last, field))
+	}
+
+	writePage(h.Logger, w, r, films, next, limit, total, facets)
 }
 
 // @Summary Search film
-// @Description get films
+// @Description full-text search over names, descriptions and cast, best matches first, with highlighted snippets
 // @Tags films
 // @Produce json
 // @Param query query string true "search query"
+// @Param mode query string false "fulltext by default, fuzzy tolerates typos in names and scores each hit, query takes field filters like actor:hanks year:>=2000 -title:sequel" Enums(fulltext, fuzzy, query)
+// @Param facets query bool false "also count the found films per decade, rating bucket and top actor"
 // @Success 200 {object} Response
 // @Failed 400 {object} ErrorResponse
 // @Failed 500 {object} ErrorResponse
@@ -94,13 +154,54 @@ func (h *FilmsHandler) SearchFilm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	films, err := h.FilmsRepo.SearchFilm(searchQuery)
+	withFacets, err := parseFacets(r)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	var films []items.FoundFilm
+	switch r.URL.Query().Get("mode") {
+	case "", searchModeFullText:
+		films, err = h.FilmsRepo.SearchFilm(searchQuery)
+	case searchModeFuzzy:
+		films, err = h.FilmsRepo.FuzzySearchFilm(searchQuery, h.Search.FuzzyThreshold)
+	case searchModeQuery:
+		var query filmql.Node
+		query, err = filmql.Parse(searchQuery)
+		var syntaxErr *filmql.Error
+		if errors.As(err, &syntaxErr) {
+			writeErrorDetails(h.Logger, w, http.StatusBadRequest, syntaxErr.Detail("query"))
+			return
+		}
+		if err == nil {
+			films, err = h.FilmsRepo.QueryFilms(query)
+		}
+	default:
+		writeError(h.Logger, w, http.StatusBadRequest, errors.New(errs.ReadingModeError))
+		return
+	}
 	if err != nil {
 		writeError(h.Logger, w, http.StatusInternalServerError, err)
 		return
 	}
 
-	writeResponse(h.Logger, w, http.StatusOK, films)
+	resp := Response{Data: films}
+	if withFacets {
+		ids := make([]uint32, len(films))
+		for i, film := range films {
+			ids[i] = film.ID
+		}
+
+		facets, err := h.FilmsRepo.FilmFacetsByIDs(ids, h.Facets.TopActors)
+		if err != nil {
+			writeError(h.Logger, w, http.StatusInternalServerError, err)
+			return
+		}
+		resp.Facets = &facets
+	}
+
+	writeResult(h.Logger, w, http.StatusOK, resp)
 }
 
 // @Summary Update film
@@ -113,6 +214,8 @@ func (h *FilmsHandler) SearchFilm(w http.ResponseWriter, r *http.Request) {
 // @Param  actor body films.Film true "film data"
 // @Success 200 {object} Response
 // @Failed 400 {object} ErrorResponse
+// @Failed 409 {object} ErrorResponse
+// @Failed 422 {object} ErrorResponse
 // @Failed 500 {object} ErrorResponse
 // @Router /api/films/{id} [post]
 func (h *FilmsHandler) UpdateFilm(w http.ResponseWriter, r *http.Request) {
@@ -135,7 +238,7 @@ func (h *FilmsHandler) UpdateFilm(w http.ResponseWriter, r *http.Request) {
 
 	err = h.FilmsRepo.UpdateFilm(film)
 	if err != nil {
-		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		writeError(h.Logger, w, writeStatus(err), err)
 		return
 	}
 
@@ -153,6 +256,8 @@ func (h *FilmsHandler) UpdateFilm(w http.ResponseWriter, r *http.Request) {
 // @Param  actor body films.Film true "film data"
 // @Success 200 {object} Response
 // @Failed 400 {object} ErrorResponse
+// @Failed 409 {object} ErrorResponse
+// @Failed 422 {object} ErrorResponse
 // @Failed 500 {object} ErrorResponse
 // @Router /api/films/{id}/{column} [post]
 func (h *FilmsHandler) UpdateColumnFilm(w http.ResponseWriter, r *http.Request) {
@@ -190,23 +295,51 @@ func (h *FilmsHandler) UpdateColumnFilm(w http.ResponseWriter, r *http.Request)
 	film.ID = uint32(id)
 
 	if columnName == "Actors" {
-		err := h.FilmsRepo.DeleteActors(film.ID)
+		err = h.FilmsRepo.ReplaceActors(film.ID, film.Actors)
 		if err != nil {
-			writeError(h.Logger, w, http.StatusInternalServerError, err)
-			return
-		}
-		err = h.FilmsRepo.InsertActors(film.ID, film.Actors)
-		if err != nil {
-			writeError(h.Logger, w, http.StatusInternalServerError, err)
+			writeError(h.Logger, w, writeStatus(err), err)
 			return
 		}
 	} else {
 		err = h.FilmsRepo.UpdateColumnFilm(film, columnName)
 		if err != nil {
-			writeError(h.Logger, w, http.StatusInternalServerError, err)
+			writeError(h.Logger, w, writeStatus(err), err)
 			return
 		}
 	}
 
 	writeResponse(h.Logger, w, http.StatusOK, film.ID)
 }
+
+// @Summary Delete film
+// @Description Delete film and its cast links
+// @Security ApiKeyAuth
+// @Tags films
+// @Produce json
+// @Param id path int true "film id"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/films/{id} [delete]
+func (h *FilmsHandler) DeleteFilm(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id, err := strconv.ParseUint(vars["FILM_ID"], 10, 32)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.FilmsRepo.DeleteFilm(uint32(id))
+	if err != nil {
+		if err.Error() == errs.NotFound {
+			writeError(h.Logger, w, http.StatusNotFound, err)
+			return
+		}
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, uint32(id))
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/items"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	actorMatchAll = "all"
+	actorMatchAny = "any"
+
+	dateLayout = "2006-01-02"
+)
+
+// parseFacets reads whether facets=true asks for the facets of the result set.
+func parseFacets(r *http.Request) (bool, error) {
+	str := r.URL.Query().Get("facets")
+	if str == "" {
+		return false, nil
+	}
+
+	facets, err := strconv.ParseBool(str)
+	if err != nil {
+		return false, errors.New(errs.ReadingFacetsError)
+	}
+
+	return facets, nil
+}
+
+// parseFilmFilter reads the GetFilms filters: date_from, date_to, rating_from,
+// rating_to, a repeatable actor with actor_match=all|any, and name_prefix.
+func parseFilmFilter(r *http.Request) (items.FilmFilter, error) {
+	query := r.URL.Query()
+
+	var filter items.FilmFilter
+	bounds := []struct {
+		param string
+		dst   **int64
+	}{
+		{"date_from", &filter.DateFrom},
+		{"date_to", &filter.DateTo},
+		{"rating_from", &filter.RatingFrom},
+		{"rating_to", &filter.RatingTo},
+	}
+	for _, bound := range bounds {
+		str := query.Get(bound.param)
+		if str == "" {
+			continue
+		}
+
+		value, err := strconv.ParseInt(str, 10, 32)
+		if err != nil {
+			return items.FilmFilter{}, filterError(bound.param)
+		}
+		*bound.dst = &value
+	}
+
+	if filter.DateFrom != nil && filter.DateTo != nil && *filter.DateFrom > *filter.DateTo {
+		return items.FilmFilter{}, filterError("date_from")
+	}
+	if filter.RatingFrom != nil && filter.RatingTo != nil && *filter.RatingFrom > *filter.RatingTo {
+		return items.FilmFilter{}, filterError("rating_from")
+	}
+
+	for _, str := range query["actor"] {
+		id, err := strconv.ParseUint(str, 10, 32)
+		if err != nil {
+			return items.FilmFilter{}, filterError("actor")
+		}
+		filter.ActorIDs = append(filter.ActorIDs, uint32(id))
+	}
+
+	switch query.Get("actor_match") {
+	case "", actorMatchAll:
+	case actorMatchAny:
+		filter.AnyActor = true
+	default:
+		return items.FilmFilter{}, filterError("actor_match")
+	}
+
+	filter.NamePrefix = query.Get("name_prefix")
+
+	return filter, nil
+}
+
+// parseActorFilter reads the SearchActors parameters: a required name, gender
+// and the born_from, born_to dates.
+func parseActorFilter(r *http.Request) (items.ActorFilter, error) {
+	query := r.URL.Query()
+
+	filter := items.ActorFilter{
+		Name:   query.Get("name"),
+		Gender: query.Get("gender"),
+	}
+	if filter.Name == "" {
+		return items.ActorFilter{}, errors.New(errs.EmptySearchError)
+	}
+
+	bounds := []struct {
+		param string
+		dst   **time.Time
+	}{
+		{"born_from", &filter.BornFrom},
+		{"born_to", &filter.BornTo},
+	}
+	for _, bound := range bounds {
+		str := query.Get(bound.param)
+		if str == "" {
+			continue
+		}
+
+		date, err := time.Parse(dateLayout, str)
+		if err != nil {
+			return items.ActorFilter{}, filterError(bound.param)
+		}
+		*bound.dst = &date
+	}
+
+	if filter.BornFrom != nil && filter.BornTo != nil && filter.BornFrom.After(*filter.BornTo) {
+		return items.ActorFilter{}, filterError("born_from")
+	}
+
+	return filter, nil
+}
+
+func filterError(param string) error {
+	return fmt.Errorf("%s: %s", errs.ReadingFilterError, param)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/items"
 	"net/http"
 	"strconv"
 
@@ -24,20 +25,28 @@ type ErrorResponse struct {
 }
 
 type Response struct {
-	Data interface{} `json:"data"`
+	Data       interface{}   `json:"data"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Total      *int          `json:"total,omitempty"`
+	Facets     *items.Facets `json:"facets,omitempty"`
 }
 
 func writeResponse(logger *zap.SugaredLogger, w http.ResponseWriter, httpStatus int, data interface{}) {
+	writeResult(logger, w, httpStatus, Response{Data: data})
+}
+
+// writeResult writes a response carrying more than data, e.g. facets.
+func writeResult(logger *zap.SugaredLogger, w http.ResponseWriter, httpStatus int, resp Response) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(httpStatus)
 
-	err := json.NewEncoder(w).Encode(Response{Data: data})
+	err := json.NewEncoder(w).Encode(resp)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info(data)
+	logger.Info(resp.Data)
 }
 
 func writeError(logger *zap.SugaredLogger, w http.ResponseWriter, httpStatus int, myErr error) {
@@ -54,6 +63,22 @@ func writeError(logger *zap.SugaredLogger, w http.ResponseWriter, httpStatus int
 	logger.Error(myErr)
 }
 
+// writeErrorDetails reports errors tied to request parameters, e.g. the
+// position of a syntax error in a search query.
+func writeErrorDetails(logger *zap.SugaredLogger, w http.ResponseWriter, httpStatus int, details ...errs.ErrorDetail) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(httpStatus)
+
+	err := json.NewEncoder(w).Encode(errs.ErrorResponse{Errors: details, Status: httpStatus})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Error(err)
+		return
+	}
+
+	logger.Error(details)
+}
+
 func parseOrderBy(r *http.Request) (string, int, error) {
 	strField := r.URL.Query().Get("field")
 	strOrder := r.URL.Query().Get("order")
@@ -77,7 +102,21 @@ func parseOrderBy(r *http.Request) (string, int, error) {
 		if strField != fieldName && strField != fieldRating && strField != fieldDate {
 			return "", 0, errors.New(errs.ReadingOrderByError)
 		}
+		field = strField
 	}
 
 	return field, order, nil
 }
+
+// writeStatus picks the status of a failed catalog write: 409 when the row
+// already exists, 422 when it breaks a foreign key or a check, 500 otherwise.
+func writeStatus(err error) int {
+	switch err.Error() {
+	case errs.DuplicateCastError:
+		return http.StatusConflict
+	case errs.ActorNotExist, errs.FilmNotExist, errs.FilmDateError, errs.FilmRatingError:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"filmlibrary/pkg/config"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/items"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+
+	fieldID = "id"
+)
+
+// pageCursor is the opaque cursor handed to clients. It remembers the
+// ordering it was issued for so it can't be replayed against another one.
+type pageCursor struct {
+	Field string      `json:"f"`
+	Order int         `json:"o"`
+	ID    uint32      `json:"id"`
+	Value interface{} `json:"v"`
+}
+
+func encodeCursor(field string, order int, id uint32, value interface{}) string {
+	data, err := json.Marshal(pageCursor{Field: field, Order: order, ID: id, Value: value})
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(str, field string, order int) (*items.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return nil, errors.New(errs.ReadingCursorError)
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New(errs.ReadingCursorError)
+	}
+
+	if cursor.Field != field || cursor.Order != order {
+		return nil, errors.New(errs.ReadingCursorError)
+	}
+
+	switch value := cursor.Value.(type) {
+	case nil:
+	case string:
+		if field != fieldName {
+			return nil, errors.New(errs.ReadingCursorError)
+		}
+	case float64:
+		if field == fieldName || value != float64(int64(value)) {
+			return nil, errors.New(errs.ReadingCursorError)
+		}
+		cursor.Value = int64(value)
+	default:
+		return nil, errors.New(errs.ReadingCursorError)
+	}
+
+	return &items.Cursor{ID: cursor.ID, Value: cursor.Value}, nil
+}
+
+// parsePage reads limit and cursor query parameters. The returned page asks
+// for one extra item so the handler knows whether a next page exists.
+func parsePage(r *http.Request, limits config.Pagination, field string, order int) (items.Page, int, error) {
+	defaultLimit, maxLimit := limits.DefaultLimit, limits.MaxLimit
+	if defaultLimit <= 0 {
+		defaultLimit = defaultPageLimit
+	}
+	if maxLimit <= 0 {
+		maxLimit = maxPageLimit
+	}
+
+	limit := defaultLimit
+	if strLimit := r.URL.Query().Get("limit"); strLimit != "" {
+		newLimit, err := strconv.Atoi(strLimit)
+		if err != nil || newLimit <= 0 {
+			return items.Page{}, 0, errors.New(errs.ReadingLimitError)
+		}
+		limit = newLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	page := items.Page{Limit: limit + 1}
+	if strCursor := r.URL.Query().Get("cursor"); strCursor != "" {
+		cursor, err := decodeCursor(strCursor, field, order)
+		if err != nil {
+			return items.Page{}, 0, err
+		}
+		page.After = cursor
+	}
+
+	return page, limit, nil
+}
+
+func filmSortValue(film items.Film, field string) interface{} {
+	switch field {
+	case fieldName:
+		return film.Name
+	case fieldDate:
+		return film.Date
+	default:
+		return film.Rating
+	}
+}
+
+func writePage(logger *zap.SugaredLogger, w http.ResponseWriter, r *http.Request, data interface{}, next string, limit, total int, facets *items.Facets) {
+	query := r.URL.Query()
+	query.Set("limit", strconv.Itoa(limit))
+	query.Del("cursor")
+
+	links := []string{fmt.Sprintf("<%s?%s>; rel=\"first\"", r.URL.Path, query.Encode())}
+	if next != "" {
+		query.Set("cursor", next)
+		links = append(links, fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.Path, query.Encode()))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+
+	writeResult(logger, w, http.StatusOK, Response{Data: data, NextCursor: next, Total: &total, Facets: facets})
+}
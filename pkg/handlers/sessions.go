@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/users"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type SessionsHandler struct {
+	UserRepo users.UserRepo
+	Logger   *zap.SugaredLogger
+}
+
+// @Summary Get my sessions
+// @Description list where the signed in user is logged in; current marks the session of the request
+// @Security ApiKeyAuth
+// @Tags sessions
+// @Produce json
+// @Success 200 {object} Response
+// @Failed 401 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/me/sessions [get]
+func (h *SessionsHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	u, ok := users.UserFromContext(r.Context())
+	if !ok || u.SessionID == "" {
+		writeError(h.Logger, w, http.StatusUnauthorized, errors.New(errs.UnauthorizedError))
+		return
+	}
+
+	sessions, err := h.UserRepo.ListSessions(u.ID, time.Now())
+	if err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == u.SessionID
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, sessions)
+}
+
+// @Summary Revoke my session
+// @Description log the signed in user out of one of their sessions, the current one included
+// @Security ApiKeyAuth
+// @Tags sessions
+// @Produce json
+// @Param id path string true "session id"
+// @Success 200 {object} Response
+// @Failed 401 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/me/sessions/{id} [delete]
+func (h *SessionsHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	u, ok := users.UserFromContext(r.Context())
+	if !ok || u.SessionID == "" {
+		writeError(h.Logger, w, http.StatusUnauthorized, errors.New(errs.UnauthorizedError))
+		return
+	}
+
+	id := mux.Vars(r)["SESSION_ID"]
+
+	revoked, err := h.UserRepo.RevokeSessions(u.ID, id, time.Now())
+	if err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+	if revoked == 0 {
+		writeError(h.Logger, w, http.StatusNotFound, errors.New(errs.SessionNotExist))
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, id)
+	h.Logger.Infof("user %v revoked session %v", u.ID, id)
+}
+
+// @Summary Revoke user sessions
+// @Description log a user out everywhere; responds with the number of sessions ended
+// @Security ApiKeyAuth
+// @Tags sessions
+// @Produce json
+// @Param id path int true "user id"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/users/{id}/sessions [delete]
+func (h *SessionsHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id, err := strconv.ParseUint(vars["USER_ID"], 10, 32)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.UserRepo.GetUserByID(uint32(id)); err != nil {
+		if err.Error() == errs.UserNotExist {
+			writeError(h.Logger, w, http.StatusNotFound, err)
+			return
+		}
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	revoked, err := h.UserRepo.RevokeSessions(uint32(id), "", time.Now())
+	if err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, revoked)
+	h.Logger.Infof("revoked %v sessions of user %v", revoked, id)
+}
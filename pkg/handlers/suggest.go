@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"filmlibrary/pkg/config"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/items"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+type SuggestHandler struct {
+	ItemsRepo items.ItemRepo
+	Config    config.Suggest
+	Logger    *zap.SugaredLogger
+}
+
+// @Summary Suggest
+// @Description film and actor names for as-you-type suggestions, best matches first
+// @Tags search
+// @Produce json
+// @Param q query string true "typed text"
+// @Param limit query int false "number of suggestions"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Failed 503 {object} ErrorResponse
+// @Router /api/suggest [get]
+func (h *SuggestHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeError(h.Logger, w, http.StatusBadRequest, errors.New(errs.EmptySearchError))
+		return
+	}
+
+	limit := h.Config.DefaultLimit
+	if strLimit := r.URL.Query().Get("limit"); strLimit != "" {
+		newLimit, err := strconv.Atoi(strLimit)
+		if err != nil || newLimit <= 0 {
+			writeError(h.Logger, w, http.StatusBadRequest, errors.New(errs.ReadingLimitError))
+			return
+		}
+		limit = newLimit
+	}
+	if limit > h.Config.MaxLimit {
+		limit = h.Config.MaxLimit
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.Config.Timeout)
+	defer cancel()
+
+	suggestions, err := h.ItemsRepo.Suggest(ctx, query, limit)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			writeError(h.Logger, w, http.StatusServiceUnavailable, errors.New(errs.SuggestTimeoutError))
+			return
+		}
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, suggestions)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/items"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type TrashHandler struct {
+	ItemsRepo items.ItemRepo
+	Retention time.Duration
+	Logger    *zap.SugaredLogger
+}
+
+// @Summary Get trash
+// @Description Get deleted films and actors
+// @Security ApiKeyAuth
+// @Tags trash
+// @Produce json
+// @Success 200 {object} Response
+// @Failed 500 {object} ErrorResponse
+// @Router /api/trash [get]
+func (h *TrashHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	trash, err := h.ItemsRepo.GetTrash()
+	if err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, trash)
+}
+
+// @Summary Restore film
+// @Description Restore deleted film
+// @Security ApiKeyAuth
+// @Tags trash
+// @Produce json
+// @Param id path int true "film id"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/trash/films/{id}/restore [post]
+func (h *TrashHandler) RestoreFilm(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id, err := strconv.ParseUint(vars["FILM_ID"], 10, 32)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.ItemsRepo.RestoreFilm(uint32(id))
+	if err != nil {
+		if err.Error() == errs.NotFound {
+			writeError(h.Logger, w, http.StatusNotFound, err)
+			return
+		}
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, uint32(id))
+}
+
+// @Summary Restore actor
+// @Description Restore deleted actor
+// @Security ApiKeyAuth
+// @Tags trash
+// @Produce json
+// @Param id path int true "actor id"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 404 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/trash/actors/{id}/restore [post]
+func (h *TrashHandler) RestoreActor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id, err := strconv.ParseUint(vars["ACTOR_ID"], 10, 32)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.ItemsRepo.RestoreActor(uint32(id))
+	if err != nil {
+		if err.Error() == errs.NotFound {
+			writeError(h.Logger, w, http.StatusNotFound, err)
+			return
+		}
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, uint32(id))
+}
+
+// @Summary Purge trash
+// @Description Permanently delete films and actors deleted earlier than older_than
+// @Security ApiKeyAuth
+// @Tags trash
+// @Produce json
+// @Param older_than query string false "minimal age of deleted items, e.g. 720h"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/trash [delete]
+func (h *TrashHandler) PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	olderThan := h.Retention
+	if strAge := r.URL.Query().Get("older_than"); strAge != "" {
+		age, err := time.ParseDuration(strAge)
+		if err != nil || age < 0 {
+			writeError(h.Logger, w, http.StatusBadRequest, errors.New(errs.ReadingAgeError))
+			return
+		}
+		olderThan = age
+	}
+
+	purged, err := h.ItemsRepo.PurgeTrash(olderThan)
+	if err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, purged)
+}
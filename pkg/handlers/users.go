@@ -3,11 +3,16 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"filmlibrary/pkg/access"
 	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/lockout"
 	"filmlibrary/pkg/session"
 	"filmlibrary/pkg/users"
+	"math"
 	"net/http"
+	"strconv"
 	"text/template"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -15,6 +20,8 @@ import (
 type UsersHandler struct {
 	Tmpl     *template.Template
 	UserRepo users.UserRepo
+	Keys     *session.Keys
+	Guard    *lockout.Guard
 	Logger   *zap.SugaredLogger
 }
 
@@ -27,6 +34,15 @@ type Token struct {
 	Token string `json:"token"`
 }
 
+type RefreshData struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type PasswordData struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
 // @Summary Register
 // @Description register new user
 // @Tags users
@@ -35,6 +51,7 @@ type Token struct {
 // @Param  actor body UserData true "user data"
 // @Success 201 {object} Response
 // @Failed 400 {object} ErrorResponse
+// @Failed 409 {object} ErrorResponse
 // @Failed 422 {object} ErrorResponse
 // @Failed 500 {object} ErrorResponse
 // @Router /api/register [post]
@@ -55,12 +72,16 @@ func (h *UsersHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	u, err := h.UserRepo.Signup(data.Username, data.Password)
 	if err != nil {
+		if err.Error() == errs.UserExistError {
+			writeError(h.Logger, w, http.StatusConflict, err)
+			return
+		}
 		writeError(h.Logger, w, http.StatusUnprocessableEntity, err)
 		return
 	}
 	h.Logger.Infof("created user %v", u.Login)
 
-	err = session.CreateToken(w, u)
+	err = h.Keys.CreateToken(w, r, u, h.UserRepo)
 	if err != nil {
 		writeError(h.Logger, w, http.StatusInternalServerError, err)
 		return
@@ -79,6 +100,7 @@ func (h *UsersHandler) Register(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} Response
 // @Failed 400 {object} ErrorResponse
 // @Failed 401 {object} ErrorResponse
+// @Failed 429 {object} ErrorResponse
 // @Failed 500 {object} ErrorResponse
 // @Router /api/login [post]
 func (h *UsersHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -90,13 +112,25 @@ func (h *UsersHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := session.ClientIP(r)
+	if !h.beginLogin(w, data.Username, ip) {
+		return
+	}
+
 	u, err := h.UserRepo.Authorize(data.Username, data.Password)
 	if err != nil {
+		if err.Error() != errs.BadPass && err.Error() != errs.UserNotExist {
+			h.releaseLogin(data.Username, ip)
+		}
 		writeError(h.Logger, w, http.StatusUnauthorized, err)
 		return
 	}
 
-	err = session.CreateToken(w, u)
+	if err := h.Guard.Succeeded(data.Username, ip); err != nil {
+		h.Logger.Errorf("clearing failed logins: %v", err)
+	}
+
+	err = h.Keys.CreateToken(w, r, u, h.UserRepo)
 	if err != nil {
 		writeError(h.Logger, w, http.StatusInternalServerError, err)
 		return
@@ -105,3 +139,208 @@ func (h *UsersHandler) Login(w http.ResponseWriter, r *http.Request) {
 	writeResponse(h.Logger, w, http.StatusOK, u.ID)
 	h.Logger.Infof("created session for %v", u.ID)
 }
+
+// @Summary Refresh tokens
+// @Description trade a refresh token for a new access token and refresh token; reusing a spent refresh token revokes every token of its login
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param  token body RefreshData true "refresh token from the X-Refresh-Token header"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 401 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/token/refresh [post]
+func (h *UsersHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var data RefreshData
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		newErr := errors.New(errs.JSONerror)
+		writeError(h.Logger, w, http.StatusBadRequest, newErr)
+		return
+	}
+
+	u, err := h.Keys.Refresh(w, data.RefreshToken, h.UserRepo)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == errs.InvalidRefreshToken || err.Error() == errs.RefreshTokenReused ||
+			err.Error() == errs.UserNotExist || err.Error() == errs.UserDisabled {
+			status = http.StatusUnauthorized
+		}
+		w.Header().Del("Authorization")
+		w.Header().Del(session.RefreshHeader)
+		writeError(h.Logger, w, status, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, u.ID)
+	h.Logger.Infof("refreshed session for %v", u.ID)
+}
+
+// @Summary Logout
+// @Description revoke the access token in use and the refresh tokens of its login
+// @Security ApiKeyAuth
+// @Tags users
+// @Produce json
+// @Success 200 {object} Response
+// @Failed 401 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/logout [post]
+func (h *UsersHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	u, ok := users.UserFromContext(r.Context())
+	if !ok || u.SessionID == "" {
+		writeError(h.Logger, w, http.StatusUnauthorized, errors.New(errs.UnauthorizedError))
+		return
+	}
+
+	if err := h.Keys.Logout(u, h.UserRepo); err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, u.ID)
+	h.Logger.Infof("closed session for %v", u.ID)
+}
+
+// @Summary Get me
+// @Description the account of the signed in user
+// @Security ApiKeyAuth
+// @Tags users
+// @Produce json
+// @Success 200 {object} Response
+// @Failed 401 {object} ErrorResponse
+// @Router /api/me [get]
+func (h *UsersHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	u, ok := users.UserFromContext(r.Context())
+	if !ok || u.Login == "" {
+		writeError(h.Logger, w, http.StatusUnauthorized, errors.New(errs.UnauthorizedError))
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, u.Account())
+}
+
+// @Summary Change password
+// @Description set a new password, given the current one; every other session of the user ends
+// @Security ApiKeyAuth
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param  password body PasswordData true "current and new password"
+// @Success 200 {object} Response
+// @Failed 400 {object} ErrorResponse
+// @Failed 401 {object} ErrorResponse
+// @Failed 403 {object} ErrorResponse
+// @Failed 422 {object} ErrorResponse
+// @Failed 429 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/me/password [post]
+func (h *UsersHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	u, ok := users.UserFromContext(r.Context())
+	if !ok || u.SessionID == "" {
+		writeError(h.Logger, w, http.StatusUnauthorized, errors.New(errs.UnauthorizedError))
+		return
+	}
+
+	var data PasswordData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		newErr := errors.New(errs.JSONerror)
+		writeError(h.Logger, w, http.StatusBadRequest, newErr)
+		return
+	}
+
+	if len(data.NewPassword) < 8 {
+		err := errors.New(errs.ShortPass)
+		writeError(h.Logger, w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	ip := session.ClientIP(r)
+	if !h.beginLogin(w, u.Login, ip) {
+		return
+	}
+
+	if _, err := h.UserRepo.Authorize(u.Login, data.OldPassword); err != nil {
+		if err.Error() == errs.BadPass {
+			writeError(h.Logger, w, http.StatusForbidden, err)
+			return
+		}
+		h.releaseLogin(u.Login, ip)
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.Guard.Succeeded(u.Login, ip); err != nil {
+		h.Logger.Errorf("clearing failed logins: %v", err)
+	}
+
+	if err := h.UserRepo.ChangePassword(u.ID, data.NewPassword, u.SessionID, time.Now()); err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, u.ID)
+	h.Logger.Infof("changed password of %v", u.ID)
+}
+
+// @Summary Delete me
+// @Description erase the account of the signed in user with its sessions; admins cannot erase their own
+// @Security ApiKeyAuth
+// @Tags users
+// @Produce json
+// @Success 200 {object} Response
+// @Failed 401 {object} ErrorResponse
+// @Failed 409 {object} ErrorResponse
+// @Failed 500 {object} ErrorResponse
+// @Router /api/me [delete]
+func (h *UsersHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	u, ok := users.UserFromContext(r.Context())
+	if !ok || u.Login == "" {
+		writeError(h.Logger, w, http.StatusUnauthorized, errors.New(errs.UnauthorizedError))
+		return
+	}
+
+	// admins cannot manage their own account, the last one would leave
+	// nobody to manage the others
+	if access.Role(u.Role) == access.Admin {
+		writeError(h.Logger, w, http.StatusConflict, errors.New(errs.OwnAccountError))
+		return
+	}
+
+	if err := h.UserRepo.DeleteUser(u.ID); err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.Guard.Unlock(u.Login); err != nil {
+		h.Logger.Errorf("clearing failed logins: %v", err)
+	}
+
+	writeResponse(h.Logger, w, http.StatusOK, u.ID)
+	h.Logger.Infof("deleted own account %v", u.ID)
+}
+
+// beginLogin starts a password guess of username from ip with the guard.
+// It answers 429 and returns false when the guess has to wait.
+func (h *UsersHandler) beginLogin(w http.ResponseWriter, username, ip string) bool {
+	wait, err := h.Guard.Begin(username, ip, time.Now())
+	if err != nil {
+		writeError(h.Logger, w, http.StatusInternalServerError, err)
+		return false
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(h.Logger, w, http.StatusTooManyRequests, errors.New(errs.TooManyAttempts))
+		return false
+	}
+
+	return true
+}
+
+// releaseLogin gives back the guess of a login that failed for another
+// reason than the password.
+func (h *UsersHandler) releaseLogin(username, ip string) {
+	if err := h.Guard.Release(username, ip); err != nil {
+		h.Logger.Errorf("releasing login attempt: %v", err)
+	}
+}
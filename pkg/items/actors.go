@@ -1,14 +1,65 @@
 package items
 
 import (
+	"database/sql"
 	"errors"
 	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/like"
+	"filmlibrary/pkg/translit"
 	"fmt"
 	"reflect"
+
+	"github.com/lib/pq"
 )
 
-func (repo *ItemMemoryRepository) GetActors() ([]Actor, error) {
-	rows, err := repo.DB.Query("SELECT id, name, gender, date FROM actors")
+func (repo *ItemMemoryRepository) GetActors(page Page) ([]Actor, int, error) {
+	var total int
+	err := repo.DB.QueryRow("SELECT count(*) FROM actors WHERE deleted_at IS NULL").Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var afterID uint32
+	if page.After != nil {
+		afterID = page.After.ID
+	}
+
+	query := "SELECT id, name, gender, date FROM actors WHERE deleted_at IS NULL AND id > $1 ORDER BY id"
+	args := []interface{}{afterID}
+	if page.Limit > 0 {
+		query += " LIMIT $2"
+		args = append(args, page.Limit)
+	}
+
+	actors, err := repo.queryActors(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = repo.loadFilmographies(actors)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return actors, total, nil
+}
+
+func (repo *ItemMemoryRepository) GetActorByID(id uint32) (Actor, error) {
+	actors, err := repo.queryActors("SELECT id, name, gender, date FROM actors WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return Actor{}, err
+	}
+
+	if len(actors) == 0 {
+		return Actor{}, sql.ErrNoRows
+	}
+
+	err = repo.loadFilmographies(actors)
+	return actors[0], err
+}
+
+func (repo *ItemMemoryRepository) queryActors(query string, args ...interface{}) ([]Actor, error) {
+	rows, err := repo.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -21,33 +72,92 @@ func (repo *ItemMemoryRepository) GetActors() ([]Actor, error) {
 		if err != nil {
 			return nil, err
 		}
+		actors = append(actors, actor)
+	}
 
-		actor.Films, err = repo.GetActorFilms(actor)
+	return actors, rows.Err()
+}
+
+// loadFilmographies fills Films of every actor with one query.
+func (repo *ItemMemoryRepository) loadFilmographies(actors []Actor) error {
+	if len(actors) == 0 {
+		return nil
+	}
+
+	actorIDs := make([]int64, len(actors))
+	for i, actor := range actors {
+		actorIDs[i] = int64(actor.ID)
+	}
+
+	rows, err := repo.DB.Query(`
+        SELECT film_actor.actor_id, films.id, films.name, films.description, films.date, films.rating
+        FROM film_actor
+        JOIN films ON films.id = film_actor.film_id
+        WHERE film_actor.actor_id = ANY($1) AND films.deleted_at IS NULL
+        ORDER BY films.id`, pq.Int64Array(actorIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	films := make(map[uint32][]Film, len(actors))
+	for rows.Next() {
+		var actorID uint32
+		var film Film
+		err := rows.Scan(&actorID, &film.ID, &film.Name, &film.Description, &film.Date, &film.Rating)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		films[actorID] = append(films[actorID], film)
+	}
 
-		actors = append(actors, actor)
+	if err := rows.Err(); err != nil {
+		return err
 	}
-	return actors, nil
+
+	for i := range actors {
+		actors[i].Films = films[actors[i].ID]
+	}
+
+	return nil
 }
 
-func (repo *ItemMemoryRepository) GetActorByID(id uint32) (Actor, error) {
-	var actor Actor
+func (repo *ItemMemoryRepository) SearchActors(filter ActorFilter) ([]FoundActor, error) {
+	var where whereClause
+	where.add("deleted_at IS NULL")
+	where.add(`(name ILIKE ? ESCAPE '\' OR search_key LIKE ?)`, "%"+like.Escape(filter.Name)+"%", searchKeyPattern(filter.Name))
 
-	stmt, err := repo.DB.Prepare("SELECT id, name, gender, date FROM actors WHERE id = $1")
-	if err != nil {
-		return Actor{}, err
+	if filter.Gender != "" {
+		where.add("lower(gender) = lower(?)", filter.Gender)
+	}
+	if filter.BornFrom != nil {
+		where.add("date >= ?", *filter.BornFrom)
+	}
+	if filter.BornTo != nil {
+		where.add("date <= ?", *filter.BornTo)
 	}
-	defer stmt.Close()
 
-	err = stmt.QueryRow(id).Scan(&actor.ID, &actor.Name, &actor.Gender, &actor.Date)
+	rows, err := repo.DB.Query(`
+        SELECT id, name, gender, date,
+            (SELECT count(*) FROM film_actor JOIN films ON films.id = film_actor.film_id
+            WHERE film_actor.actor_id = actors.id AND films.deleted_at IS NULL)
+        FROM actors`+where.String()+" ORDER BY name, id", where.args...)
 	if err != nil {
-		return Actor{}, err
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actors []FoundActor
+	for rows.Next() {
+		var actor FoundActor
+		err := rows.Scan(&actor.ID, &actor.Name, &actor.Gender, &actor.Date, &actor.FilmCount)
+		if err != nil {
+			return nil, err
+		}
+		actors = append(actors, actor)
 	}
 
-	actor.Films, err = repo.GetActorFilms(actor)
-	return actor, err
+	return actors, nil
 }
 
 func (repo *ItemMemoryRepository) CreateActor(actor Actor) (uint32, error) {
@@ -65,13 +175,13 @@ func (repo *ItemMemoryRepository) CreateActor(actor Actor) (uint32, error) {
 		actor.Date = nil
 	}
 
-	stmt, err := repo.DB.Prepare("INSERT INTO actors(name, gender, date) VALUES($1, $2, $3) RETURNING id")
+	stmt, err := repo.DB.Prepare("INSERT INTO actors(name, gender, date, search_key) VALUES($1, $2, $3, $4) RETURNING id")
 	if err != nil {
 		return 0, errors.New(errs.DatabaseError)
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(actor.Name, actor.Gender, actor.Date).Scan(&actor.ID)
+	err = stmt.QueryRow(actor.Name, actor.Gender, actor.Date, translit.Normalize(actor.Name)).Scan(&actor.ID)
 	return actor.ID, err
 }
 
@@ -90,15 +200,29 @@ func (repo *ItemMemoryRepository) UpdateActor(actor Actor) error {
 	if actor.Date.(string) == "" {
 		actor.Date = nil
 	}
-	stmt, err := repo.DB.Prepare("UPDATE actors SET name = $1, gender = $2, date = $3 WHERE id = $4")
+	// the actor may have gone to the trash since it was read
+	stmt, err := repo.DB.Prepare("UPDATE actors SET name = $1, gender = $2, date = $3, search_key = $4 WHERE id = $5 AND deleted_at IS NULL")
 	if err != nil {
 		return err
 	}
 
 	defer stmt.Close()
 
-	_, err = stmt.Exec(actor.Name, actor.Gender, actor.Date, id)
-	return err
+	result, err := stmt.Exec(actor.Name, actor.Gender, actor.Date, translit.Normalize(actor.Name), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errors.New(errs.ActorNotExist)
+	}
+
+	return nil
 }
 
 func (repo *ItemMemoryRepository) UpdateColumnActor(actor Actor, columnName string) error {
@@ -119,16 +243,35 @@ func (repo *ItemMemoryRepository) UpdateColumnActor(actor Actor, columnName stri
 	if value.(string) == "" {
 		value = nil
 	}
-	query := fmt.Sprintf("UPDATE actors SET %s = $1 WHERE id = $2", columnName)
+	// the actor may have gone to the trash since it was read
+	query := fmt.Sprintf("UPDATE actors SET %s = $1 WHERE id = $2 AND deleted_at IS NULL", columnName)
+	args := []interface{}{value, id}
+	if columnName == "Name" {
+		query = "UPDATE actors SET name = $1, search_key = $3 WHERE id = $2 AND deleted_at IS NULL"
+		args = append(args, translit.Normalize(actor.Name))
+	}
+
 	stmt, err := repo.DB.Prepare(query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(value, id)
+	result, err := stmt.Exec(args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
 
-	return err
+	return nil
 }
 
 func (repo *ItemMemoryRepository) ActorsByFilm(film Film) ([]Actor, error) {
@@ -136,7 +279,8 @@ func (repo *ItemMemoryRepository) ActorsByFilm(film Film) ([]Actor, error) {
         SELECT id, name, gender, date 
         FROM actors 
         JOIN (SELECT actor_id FROM film_actor WHERE film_id = $1) AS film_actors
-        ON actors.id = film_actors.actor_id`)
+        ON actors.id = film_actors.actor_id
+        WHERE actors.deleted_at IS NULL`)
 	if err != nil {
 		return nil, err
 	}
@@ -159,3 +303,39 @@ func (repo *ItemMemoryRepository) ActorsByFilm(film Film) ([]Actor, error) {
 	}
 	return filmActors, nil
 }
+
+func (repo *ItemMemoryRepository) DeleteActor(id uint32) error {
+	result, err := repo.DB.Exec("UPDATE actors SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errors.New(errs.NotFound)
+	}
+
+	return nil
+}
+
+func (repo *ItemMemoryRepository) RestoreActor(id uint32) error {
+	result, err := repo.DB.Exec("UPDATE actors SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errors.New(errs.NotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package items
+
+import (
+	"errors"
+	"filmlibrary/pkg/errs"
+
+	"github.com/lib/pq"
+)
+
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+	checkViolation      = "23514"
+)
+
+// constraintError turns a catalog constraint violation into an errs message
+// handlers can map to a status. Other errors are returned unchanged.
+func constraintError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch {
+	case pqErr.Code == uniqueViolation && pqErr.Constraint == "film_actor_pkey":
+		return errors.New(errs.DuplicateCastError)
+	case pqErr.Code == foreignKeyViolation && pqErr.Constraint == "film_actor_actor_id_fkey":
+		return errors.New(errs.ActorNotExist)
+	case pqErr.Code == foreignKeyViolation && pqErr.Constraint == "film_actor_film_id_fkey":
+		return errors.New(errs.FilmNotExist)
+	case pqErr.Code == checkViolation && pqErr.Constraint == "films_date_check":
+		return errors.New(errs.FilmDateError)
+	case pqErr.Code == checkViolation && pqErr.Constraint == "films_rating_check":
+		return errors.New(errs.FilmRatingError)
+	}
+
+	return err
+}
@@ -0,0 +1,120 @@
+package items
+
+import (
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+const (
+	facetDecade = "decade"
+	facetRating = "rating"
+	facetActor  = "actor"
+)
+
+// FilmFacets counts the facets of the films GetFilms returns for filter,
+// across all pages.
+func (repo *ItemMemoryRepository) FilmFacets(filter FilmFilter, topActors int) (Facets, error) {
+	return repo.facets(filmsWhere(filter), topActors)
+}
+
+// FilmFacetsByIDs counts the facets of the given films, e.g. search results.
+func (repo *ItemMemoryRepository) FilmFacetsByIDs(ids []uint32, topActors int) (Facets, error) {
+	filmIDs := make(pq.Int64Array, len(ids))
+	for i, id := range ids {
+		filmIDs[i] = int64(id)
+	}
+
+	var where whereClause
+	where.add("deleted_at IS NULL")
+	where.add("id = ANY(?)", filmIDs)
+
+	return repo.facets(where, topActors)
+}
+
+// facets aggregates all three facets of the films matching where in one query.
+func (repo *ItemMemoryRepository) facets(where whereClause, topActors int) (Facets, error) {
+	limit := where.placeholder(topActors)
+
+	rows, err := repo.DB.Query(`
+        WITH result AS (SELECT id, date, rating FROM films`+where.String()+`)
+        SELECT 'decade', date / 10 * 10, '', count(*) FROM result WHERE date IS NOT NULL GROUP BY 2
+        UNION ALL
+        SELECT 'rating', greatest(rating - 1, 0) / 2, '', count(*) FROM result WHERE rating IS NOT NULL GROUP BY 2
+        UNION ALL
+        (SELECT 'actor', actors.id, coalesce(actors.name, ''), count(*)
+        FROM result
+        JOIN film_actor ON film_actor.film_id = result.id
+        JOIN actors ON actors.id = film_actor.actor_id AND actors.deleted_at IS NULL
+        GROUP BY actors.id
+        ORDER BY count(*) DESC, actors.id
+        LIMIT `+limit+`)`, where.args...)
+	if err != nil {
+		return Facets{}, err
+	}
+	defer rows.Close()
+
+	facets := newFacets()
+	for rows.Next() {
+		var kind, name string
+		var key int64
+		var count int
+		if err := rows.Scan(&kind, &key, &name, &count); err != nil {
+			return Facets{}, err
+		}
+
+		switch kind {
+		case facetDecade:
+			facets.Decades = append(facets.Decades, DecadeFacet{Decade: key, Count: count})
+		case facetRating:
+			facets.Ratings = append(facets.Ratings, ratingFacet(key, count))
+		case facetActor:
+			facets.Actors = append(facets.Actors, ActorFacet{ID: uint32(key), Name: name, Count: count})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Facets{}, err
+	}
+
+	sortFacets(&facets)
+	return facets, nil
+}
+
+// newFacets has empty rather than nil lists, so they encode as [].
+func newFacets() Facets {
+	return Facets{Decades: []DecadeFacet{}, Ratings: []RatingFacet{}, Actors: []ActorFacet{}}
+}
+
+// ratingBucket numbers the rating buckets from 0 for 0-2 to 4 for 9-10.
+func ratingBucket(rating int64) int64 {
+	if rating < 1 {
+		return 0
+	}
+	return (rating - 1) / 2
+}
+
+func ratingFacet(bucket int64, count int) RatingFacet {
+	facet := RatingFacet{From: 2*bucket + 1, To: 2*bucket + 2, Count: count}
+	if bucket == 0 {
+		facet.From = 0
+	}
+	return facet
+}
+
+// sortFacets orders decades and ratings ascending and actors by film count,
+// most films first.
+func sortFacets(facets *Facets) {
+	sort.Slice(facets.Decades, func(i, j int) bool {
+		return facets.Decades[i].Decade < facets.Decades[j].Decade
+	})
+	sort.Slice(facets.Ratings, func(i, j int) bool {
+		return facets.Ratings[i].From < facets.Ratings[j].From
+	})
+	sort.Slice(facets.Actors, func(i, j int) bool {
+		a, b := facets.Actors[i], facets.Actors[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.ID < b.ID
+	})
+}
@@ -1,19 +1,48 @@
 package items
 
 import (
+	"database/sql"
+	"errors"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/filmql"
+	"filmlibrary/pkg/like"
+	"filmlibrary/pkg/translit"
 	"fmt"
 	"reflect"
+	"strconv"
+
+	"github.com/lib/pq"
 )
 
-func (repo *ItemMemoryRepository) GetFilms(field string, order int) ([]Film, error) {
-	orderBy := "ORDER BY " + field + " DESC"
+func (repo *ItemMemoryRepository) GetFilms(field string, order int, filter FilmFilter, page Page) ([]Film, int, error) {
+	where := filmsWhere(filter)
+
+	var total int
+	err := repo.DB.QueryRow("SELECT count(*) FROM films"+where.String(), where.args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	direction := "DESC NULLS FIRST"
+	idDirection := "DESC"
 	if order == 1 {
-		orderBy = "ORDER BY " + field + " ASC"
+		direction = "ASC NULLS LAST"
+		idDirection = "ASC"
 	}
 
-	rows, err := repo.DB.Query("SELECT id, name, description, date, rating FROM films " + orderBy)
+	if page.After != nil {
+		addAfterCondition(&where, field, order, page.After)
+	}
+
+	query := "SELECT id, name, description, date, rating FROM films" + where.String()
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", field, direction, idDirection)
+	if page.Limit > 0 {
+		query += " LIMIT " + where.placeholder(page.Limit)
+	}
+
+	rows, err := repo.DB.Query(query, where.args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
@@ -22,32 +51,146 @@ func (repo *ItemMemoryRepository) GetFilms(field string, order int) ([]Film, err
 		var film Film
 		err := rows.Scan(&film.ID, &film.Name, &film.Description, &film.Date, &film.Rating)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		films = append(films, film)
 	}
 
-	return films, nil
+	return films, total, nil
+}
+
+// filmsWhere turns a FilmFilter into the conditions on alive films.
+func filmsWhere(filter FilmFilter) whereClause {
+	var where whereClause
+	where.add("deleted_at IS NULL")
+
+	if filter.DateFrom != nil {
+		where.add("date >= ?", *filter.DateFrom)
+	}
+	if filter.DateTo != nil {
+		where.add("date <= ?", *filter.DateTo)
+	}
+	if filter.RatingFrom != nil {
+		where.add("rating >= ?", *filter.RatingFrom)
+	}
+	if filter.RatingTo != nil {
+		where.add("rating <= ?", *filter.RatingTo)
+	}
+	if filter.NamePrefix != "" {
+		where.add(`name ILIKE ? ESCAPE '\'`, like.Escape(filter.NamePrefix)+"%")
+	}
+
+	if len(filter.ActorIDs) > 0 {
+		actorIDs := make(pq.Int64Array, len(filter.ActorIDs))
+		for i, id := range filter.ActorIDs {
+			actorIDs[i] = int64(id)
+		}
+
+		if filter.AnyActor {
+			where.add("id IN (SELECT film_id FROM film_actor WHERE actor_id = ANY(?))", actorIDs)
+		} else {
+			where.add(`id IN (SELECT film_id FROM film_actor WHERE actor_id = ANY(?)
+            GROUP BY film_id HAVING count(*) = ?)`, actorIDs, len(distinctIDs(filter.ActorIDs)))
+		}
+	}
+
+	return where
+}
+
+// addAfterCondition selects rows following the cursor in the GetFilms ordering,
+// where NULL sorts after any value like it does in Postgres.
+func addAfterCondition(where *whereClause, field string, order int, after *Cursor) {
+	switch {
+	case order == 1 && after.Value == nil:
+		where.add(fmt.Sprintf("(%s IS NULL AND id > ?)", field), after.ID)
+	case order == 1:
+		where.add(fmt.Sprintf("(%[1]s > ? OR (%[1]s = ? AND id > ?) OR %[1]s IS NULL)", field), after.Value, after.Value, after.ID)
+	case after.Value == nil:
+		where.add(fmt.Sprintf("(%s IS NOT NULL OR id < ?)", field), after.ID)
+	default:
+		where.add(fmt.Sprintf("(%[1]s < ? OR (%[1]s = ? AND id < ?))", field), after.Value, after.Value, after.ID)
+	}
 }
 
 func (repo *ItemMemoryRepository) GetFilmByID(id uint32) (Film, error) {
+	rows, err := repo.DB.Query(`
+        SELECT films.id, films.name, films.description, films.date, films.rating,
+            actors.id, actors.name, actors.gender, actors.date
+        FROM films
+        LEFT JOIN film_actor ON film_actor.film_id = films.id
+        LEFT JOIN actors ON actors.id = film_actor.actor_id AND actors.deleted_at IS NULL
+        WHERE films.id = $1 AND films.deleted_at IS NULL
+        ORDER BY actors.id`, id)
+	if err != nil {
+		return Film{}, err
+	}
+	defer rows.Close()
+
 	var film Film
+	found := false
+	for rows.Next() {
+		var actorID sql.NullInt64
+		var actorName, actorGender sql.NullString
+		var actorDate interface{}
+		err := rows.Scan(&film.ID, &film.Name, &film.Description, &film.Date, &film.Rating,
+			&actorID, &actorName, &actorGender, &actorDate)
+		if err != nil {
+			return Film{}, err
+		}
+		found = true
+
+		if actorID.Valid {
+			film.Actors = append(film.Actors, Actor{
+				ID:     uint32(actorID.Int64),
+				Name:   actorName.String,
+				Gender: actorGender.String,
+				Date:   actorDate,
+			})
+		}
+	}
 
-	err := repo.DB.QueryRow("SELECT id, name, description, date, rating FROM films WHERE id = $1", id).Scan(&film.ID, &film.Name, &film.Description, &film.Date, &film.Rating)
-	if err != nil {
+	if err := rows.Err(); err != nil {
 		return Film{}, err
 	}
 
-	film.Actors, err = repo.ActorsByFilm(film)
-	if err != nil {
-		return film, err
+	if !found {
+		return Film{}, sql.ErrNoRows
 	}
 
 	return film, nil
 }
 
 func (repo *ItemMemoryRepository) DeleteActors(filmID uint32) error {
-	_, err := repo.DB.Exec("DELETE FROM film_actor WHERE film_id = $1;", filmID)
+	return deleteActors(repo.DB, filmID)
+}
+
+func (repo *ItemMemoryRepository) InsertActors(filmID uint32, actors []Actor) error {
+	return insertActors(repo.DB, filmID, actors)
+}
+
+func (repo *ItemMemoryRepository) ReplaceActors(filmID uint32, actors []Actor) error {
+	return repo.inTx(func(q Querier) error {
+		var exists bool
+		err := q.QueryRow("SELECT EXISTS (SELECT 1 FROM films WHERE id = $1 AND deleted_at IS NULL)", filmID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return sql.ErrNoRows
+		}
+
+		err = deleteActors(q, filmID)
+		if err != nil {
+			return err
+		}
+
+		return insertActors(q, filmID, actors)
+	})
+}
+
+func deleteActors(q Querier, filmID uint32) error {
+	_, err := q.Exec("DELETE FROM film_actor WHERE film_id = $1;", filmID)
 	if err != nil {
 		return err
 	}
@@ -55,13 +198,17 @@ func (repo *ItemMemoryRepository) DeleteActors(filmID uint32) error {
 	return nil
 }
 
-func (repo *ItemMemoryRepository) InsertActors(filmID uint32, actors []Actor) error {
+func insertActors(q Querier, filmID uint32, actors []Actor) error {
+	if len(actors) == 0 {
+		return nil
+	}
+
 	actorIDs := make([]uint32, len(actors))
 	for i, actor := range actors {
 		actorIDs[i] = actor.ID
 	}
 
-	stmt, err := repo.DB.Prepare("INSERT INTO film_actor (film_id, actor_id) VALUES ($1, $2)")
+	stmt, err := q.Prepare("INSERT INTO film_actor (film_id, actor_id) VALUES ($1, $2)")
 	if err != nil {
 		return err
 	}
@@ -70,7 +217,7 @@ func (repo *ItemMemoryRepository) InsertActors(filmID uint32, actors []Actor) er
 	for _, actorID := range actorIDs {
 		_, err := stmt.Exec(filmID, actorID)
 		if err != nil {
-			return err
+			return constraintError(err)
 		}
 	}
 
@@ -78,79 +225,132 @@ func (repo *ItemMemoryRepository) InsertActors(filmID uint32, actors []Actor) er
 }
 
 func (repo *ItemMemoryRepository) CreateFilm(film Film) (uint32, error) {
-	stmt, err := repo.DB.Prepare("INSERT INTO films(name, description, date, rating) VALUES($1, $2, $3, $4) RETURNING id")
-	if err != nil {
-		return 0, err
-	}
-	defer stmt.Close()
+	err := repo.inTx(func(q Querier) error {
+		err := q.QueryRow("INSERT INTO films(name, description, date, rating, search_key) VALUES($1, $2, $3, $4, $5) RETURNING id",
+			film.Name, film.Description, film.Date, film.Rating, translit.Normalize(film.Name)).Scan(&film.ID)
+		if err != nil {
+			return err
+		}
 
-	err = stmt.QueryRow(film.Name, film.Description, film.Date, film.Rating).Scan(&film.ID)
+		return insertActors(q, film.ID, film.Actors)
+	})
 	if err != nil {
-		return 0, err
+		return 0, constraintError(err)
 	}
 
-	if len(film.Actors) == 0 {
-		return uint32(film.ID), err
-	}
+	return film.ID, nil
+}
+
+func (repo *ItemMemoryRepository) UpdateFilm(film Film) error {
+	err := repo.inTx(func(q Querier) error {
+		result, err := q.Exec("UPDATE films SET name = $1, description = $2, date = $3, rating = $4, search_key = $5 WHERE id = $6 AND deleted_at IS NULL",
+			film.Name, film.Description, film.Date, film.Rating, translit.Normalize(film.Name), film.ID)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
+
+		err = deleteActors(q, film.ID)
+		if err != nil {
+			return err
+		}
 
-	err = repo.InsertActors(film.ID, film.Actors)
+		return insertActors(q, film.ID, film.Actors)
+	})
 
-	return uint32(film.ID), err
+	return constraintError(err)
 }
 
-func (repo *ItemMemoryRepository) UpdateFilm(film Film) error {
-	_, err := repo.GetFilmByID(film.ID)
+func (repo *ItemMemoryRepository) UpdateColumnFilm(film Film, columnName string) error {
+	id := film.ID
+	_, err := repo.GetFilmByID(id)
 	if err != nil {
 		return err
 	}
 
-	_, err = repo.DB.Exec("UPDATE films SET name = $1, description = $2, date = $3, rating = $4 WHERE id = $5", film.Name, film.Description, film.Date, film.Rating, film.ID)
+	r := reflect.ValueOf(film)
+	columnValue := reflect.Indirect(r).FieldByName(columnName).Interface()
+
+	// the film may have gone to the trash since it was read
+	query := fmt.Sprintf("UPDATE films SET %s = $1 WHERE id = $2 AND deleted_at IS NULL", columnName)
+	args := []interface{}{columnValue, id}
+	if columnName == "Name" {
+		query = "UPDATE films SET name = $1, search_key = $3 WHERE id = $2 AND deleted_at IS NULL"
+		args = append(args, translit.Normalize(film.Name))
+	}
+
+	result, err := repo.DB.Exec(query, args...)
 	if err != nil {
-		return err
+		return constraintError(err)
 	}
 
-	err = repo.DeleteActors(film.ID)
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
-	if len(film.Actors) == 0 {
-		return err
+	if affected == 0 {
+		return sql.ErrNoRows
 	}
 
-	err = repo.InsertActors(film.ID, film.Actors)
-	return err
+	return nil
 }
 
-func (repo *ItemMemoryRepository) UpdateColumnFilm(film Film, columnName string) error {
-	id := film.ID
-	_, err := repo.GetFilmByID(id)
+// SearchFilm runs a full-text search over film names, descriptions and cast
+// names, best matches first. Names weigh more than the cast, the cast more
+// than descriptions. Names written in the other alphabet match by search
+// key and go last.
+func (repo *ItemMemoryRepository) SearchFilm(searchQuery string) ([]FoundFilm, error) {
+	rows, err := repo.DB.Query(`
+        SELECT id, name, description, date, rating,
+            ts_headline('russian', concat_ws('. ', name, NULLIF(description, ''), film_cast_names(id)), query)
+        FROM films, film_search_query($1) AS query
+        WHERE deleted_at IS NULL AND (search_vector @@ query OR search_key LIKE $2 OR id IN (
+            SELECT film_actor.film_id FROM film_actor JOIN actors ON actors.id = film_actor.actor_id
+            WHERE actors.search_key LIKE $2 AND actors.deleted_at IS NULL))
+        ORDER BY ts_rank(search_vector, query) DESC, id`, searchQuery, searchKeyPattern(searchQuery))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	r := reflect.ValueOf(film)
-	columnValue := reflect.Indirect(r).FieldByName(columnName).Interface()
+	var films []FoundFilm
+	for rows.Next() {
+		var film FoundFilm
+		err := rows.Scan(&film.ID, &film.Name, &film.Description, &film.Date, &film.Rating, &film.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		films = append(films, film)
+	}
 
-	query := fmt.Sprintf("UPDATE films SET %s = $1 WHERE id = $2", columnName)
-	_, err = repo.DB.Exec(query, columnValue, id)
-	return err
+	return films, nil
 }
 
-func (repo *ItemMemoryRepository) SearchFilm(searchQuery string) ([]Film, error) {
-	rows, err := repo.DB.Query("SELECT DISTINCT films.id, films.name, films.description, films.Date, films.rating FROM films WHERE films.name ILIKE $1 "+
-		"UNION SELECT DISTINCT films.id, films.name, films.description, films.Date, films.rating FROM films JOIN film_actor ON films.id = film_actor.film_id "+
-		"JOIN actors ON film_actor.actor_id = actors.id "+
-		"WHERE actors.name ILIKE $2", "%"+searchQuery+"%", "%"+searchQuery+"%")
+// QueryFilms finds the films matching a search language query, ordered by id.
+func (repo *ItemMemoryRepository) QueryFilms(query filmql.Node) ([]FoundFilm, error) {
+	var where whereClause
+	where.add("deleted_at IS NULL")
+	condition, args := filmql.SQL(query)
+	where.add(condition, args...)
 
+	rows, err := repo.DB.Query("SELECT id, name, description, date, rating FROM films"+where.String()+" ORDER BY id", where.args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var films []Film
+	var films []FoundFilm
 	for rows.Next() {
-		var film Film
+		var film FoundFilm
 		err := rows.Scan(&film.ID, &film.Name, &film.Description, &film.Date, &film.Rating)
 		if err != nil {
 			return nil, err
@@ -158,6 +358,45 @@ func (repo *ItemMemoryRepository) SearchFilm(searchQuery string) ([]Film, error)
 		films = append(films, film)
 	}
 
+	return films, rows.Err()
+}
+
+// FuzzySearchFilm finds films with a name word similar to the query, so
+// misspelled titles still match. Hits below threshold are dropped.
+func (repo *ItemMemoryRepository) FuzzySearchFilm(searchQuery string, threshold float64) ([]FoundFilm, error) {
+	var films []FoundFilm
+	err := repo.inTx(func(q Querier) error {
+		// <% uses the trigram index, but only with the threshold set this way
+		_, err := q.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)", strconv.FormatFloat(threshold, 'f', -1, 64))
+		if err != nil {
+			return err
+		}
+
+		rows, err := q.Query(`
+            SELECT id, name, description, date, rating, round(word_similarity(lower($1), lower(name))::numeric, 3)::float8 AS score
+            FROM films
+            WHERE lower($1) <% lower(name) AND deleted_at IS NULL
+            ORDER BY score DESC, id`, searchQuery)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var film FoundFilm
+			err := rows.Scan(&film.ID, &film.Name, &film.Description, &film.Date, &film.Rating, &film.Score)
+			if err != nil {
+				return err
+			}
+			films = append(films, film)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return films, nil
 }
 
@@ -166,7 +405,8 @@ func (repo *ItemMemoryRepository) GetActorFilms(actor Actor) ([]Film, error) {
         SELECT id, name, description, date, rating 
         FROM films
         JOIN (SELECT film_id FROM film_actor WHERE actor_id = $1) AS film_actors
-        ON films.id = film_actors.film_id`)
+        ON films.id = film_actors.film_id
+        WHERE films.deleted_at IS NULL`)
 	if err != nil {
 		return nil, err
 	}
@@ -189,3 +429,39 @@ func (repo *ItemMemoryRepository) GetActorFilms(actor Actor) ([]Film, error) {
 	}
 	return films, nil
 }
+
+func (repo *ItemMemoryRepository) DeleteFilm(id uint32) error {
+	result, err := repo.DB.Exec("UPDATE films SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errors.New(errs.NotFound)
+	}
+
+	return nil
+}
+
+func (repo *ItemMemoryRepository) RestoreFilm(id uint32) error {
+	result, err := repo.DB.Exec("UPDATE films SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errors.New(errs.NotFound)
+	}
+
+	return nil
+}
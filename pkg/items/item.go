@@ -1,9 +1,12 @@
 package items
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/filmql"
+	"time"
 )
 
 type Actor struct {
@@ -31,23 +34,145 @@ type Film struct {
 	Actors      []Actor     `json:"actors"`
 }
 
+// FoundFilm is a SearchFilm or FuzzySearchFilm result. Snippet is the
+// matched text with the matching words wrapped in <b></b>, Score is the
+// similarity of a fuzzy hit.
+type FoundFilm struct {
+	Film
+	Snippet string  `json:"snippet,omitempty"`
+	Score   float64 `json:"score,omitempty"`
+}
+
+// ActorFilter selects SearchActors results. Name matches any part of the
+// actor name ignoring case; the other fields are not applied when empty.
+type ActorFilter struct {
+	Name     string
+	Gender   string
+	BornFrom *time.Time
+	BornTo   *time.Time
+}
+
+// FoundActor is a SearchActors result with the number of films the actor plays in.
+type FoundActor struct {
+	Actor
+	FilmCount int `json:"film_count"`
+}
+
+// Facets counts the films of a result set per decade, per rating bucket
+// and per actor, for the actors playing in most of them. Films without a
+// date or rating are not counted in those facets.
+type Facets struct {
+	Decades []DecadeFacet `json:"decades"`
+	Ratings []RatingFacet `json:"ratings"`
+	Actors  []ActorFacet  `json:"actors"`
+}
+
+// DecadeFacet counts the films released from Decade to Decade+9.
+type DecadeFacet struct {
+	Decade int64 `json:"decade"`
+	Count  int   `json:"count"`
+}
+
+// RatingFacet counts the films rated From to To, inclusive: 0-2, 3-4, 5-6,
+// 7-8 and 9-10.
+type RatingFacet struct {
+	From  int64 `json:"from"`
+	To    int64 `json:"to"`
+	Count int   `json:"count"`
+}
+
+// ActorFacet counts the films of the result set the actor plays in.
+type ActorFacet struct {
+	ID    uint32 `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+const (
+	SuggestFilm  = "film"
+	SuggestActor = "actor"
+)
+
+// Suggestion is a film or actor name offered while the user types.
+// Score is higher for better matches.
+type Suggestion struct {
+	Type  string  `json:"type"`
+	ID    uint32  `json:"id"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+type DeletedFilm struct {
+	Film
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type DeletedActor struct {
+	Actor
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type Trash struct {
+	Films  []DeletedFilm  `json:"films"`
+	Actors []DeletedActor `json:"actors"`
+}
+
+// Cursor is the sort key of the last item of the previous page.
+type Cursor struct {
+	ID    uint32
+	Value interface{}
+}
+
+// FilmFilter narrows GetFilms. Nil bounds and empty fields are not applied;
+// bounds are inclusive and never match a NULL date or rating.
+type FilmFilter struct {
+	DateFrom   *int64
+	DateTo     *int64
+	RatingFrom *int64
+	RatingTo   *int64
+	// ActorIDs keeps films with all of the actors, or any of them if AnyActor is set.
+	ActorIDs   []uint32
+	AnyActor   bool
+	NamePrefix string
+}
+
+// Page selects up to Limit items following After; zero Limit means no limit.
+type Page struct {
+	Limit int
+	After *Cursor
+}
+
 type ItemRepo interface {
 	CreateFilm(film Film) (uint32, error)
 	GetFilmByID(id uint32) (Film, error)
-	GetFilms(field string, order int) ([]Film, error)
+	GetFilms(field string, order int, filter FilmFilter, page Page) ([]Film, int, error)
 	UpdateFilm(film Film) error
 	UpdateColumnFilm(film Film, columnName string) error
-	SearchFilm(searchQuery string) ([]Film, error)
+	SearchFilm(searchQuery string) ([]FoundFilm, error)
+	FuzzySearchFilm(searchQuery string, threshold float64) ([]FoundFilm, error)
+	QueryFilms(query filmql.Node) ([]FoundFilm, error)
+	FilmFacets(filter FilmFilter, topActors int) (Facets, error)
+	FilmFacetsByIDs(ids []uint32, topActors int) (Facets, error)
+	Suggest(ctx context.Context, query string, limit int) ([]Suggestion, error)
 	DeleteActors(filmID uint32) error
 	InsertActors(filmID uint32, actors []Actor) error
+	ReplaceActors(filmID uint32, actors []Actor) error
 	GetActorFilms(actor Actor) ([]Film, error)
+	DeleteFilm(id uint32) error
+	RestoreFilm(id uint32) error
 
 	CreateActor(actor Actor) (uint32, error)
 	GetActorByID(id uint32) (Actor, error)
-	GetActors() ([]Actor, error)
+	GetActors(page Page) ([]Actor, int, error)
+	SearchActors(filter ActorFilter) ([]FoundActor, error)
 	UpdateActor(actor Actor) error
 	UpdateColumnActor(actor Actor, columnName string) error
 	ActorsByFilm(film Film) ([]Actor, error)
+	DeleteActor(id uint32) error
+	RestoreActor(id uint32) error
+
+	GetTrash() (Trash, error)
+	PurgeTrash(olderThan time.Duration) (int64, error)
 }
 
 type ItemMemoryRepository struct {
@@ -0,0 +1,1181 @@
+package items
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/filmql"
+	"filmlibrary/pkg/translit"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ItemMapRepository keeps films, actors and the film/actor relation in maps.
+// It mirrors the behaviour of ItemMemoryRepository without a database.
+type ItemMapRepository struct {
+	mu          sync.RWMutex
+	films       map[uint32]*mapFilm
+	actors      map[uint32]*mapActor
+	filmActors  map[filmActorKey]struct{}
+	lastFilmID  uint32
+	lastActorID uint32
+}
+
+type mapFilm struct {
+	Film
+	deletedAt time.Time
+}
+
+type mapActor struct {
+	Actor
+	deletedAt time.Time
+}
+
+type filmActorKey struct {
+	filmID  uint32
+	actorID uint32
+}
+
+var actorDateLayouts = []string{
+	"2006-01-02",
+	"01-02-2006",
+	"01/02/2006",
+	time.RFC3339,
+}
+
+func NewMapRepo() *ItemMapRepository {
+	return &ItemMapRepository{
+		films:      make(map[uint32]*mapFilm),
+		actors:     make(map[uint32]*mapActor),
+		filmActors: make(map[filmActorKey]struct{}),
+	}
+}
+
+func (repo *ItemMapRepository) CreateFilm(film Film) (uint32, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, err := repo.newFilmRow(film)
+	if err != nil {
+		return 0, err
+	}
+
+	repo.lastFilmID++
+	stored.ID = repo.lastFilmID
+	if err := stored.check(); err != nil {
+		return 0, err
+	}
+
+	if err := repo.checkCast(film.Actors); err != nil {
+		return 0, err
+	}
+
+	repo.films[stored.ID] = stored
+	repo.insertActors(stored.ID, film.Actors)
+
+	return stored.ID, nil
+}
+
+func (repo *ItemMapRepository) GetFilmByID(id uint32) (Film, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	stored, ok := repo.films[id]
+	if !ok || !stored.deletedAt.IsZero() {
+		return Film{}, sql.ErrNoRows
+	}
+
+	film := stored.Film
+	film.Actors = repo.actorsByFilm(id)
+
+	return film, nil
+}
+
+func (repo *ItemMapRepository) GetFilms(field string, order int, filter FilmFilter, page Page) ([]Film, int, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	if _, err := compareFilms(Film{}, Film{}, field); err != nil {
+		return nil, 0, err
+	}
+
+	// before reports whether a goes first in the requested ordering.
+	before := func(a, b Film) bool {
+		cmp, _ := compareFilms(a, b, field)
+		if cmp == 0 {
+			cmp = compareIDs(a.ID, b.ID)
+		}
+		if order == 1 {
+			return cmp < 0
+		}
+		return cmp > 0
+	}
+
+	var films []Film
+	for _, film := range repo.aliveFilms() {
+		if repo.matchFilm(film, filter) {
+			films = append(films, film)
+		}
+	}
+	total := len(films)
+	sort.Slice(films, func(i, j int) bool {
+		return before(films[i], films[j])
+	})
+
+	if page.After != nil {
+		pivot, err := cursorFilm(field, page.After)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		start := sort.Search(len(films), func(i int) bool {
+			return before(pivot, films[i])
+		})
+		films = films[start:]
+	}
+
+	if page.Limit > 0 && len(films) > page.Limit {
+		films = films[:page.Limit]
+	}
+
+	if len(films) == 0 {
+		return nil, total, nil
+	}
+
+	return films, total, nil
+}
+
+func (repo *ItemMapRepository) UpdateFilm(film Film) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.films[film.ID]
+	if !ok || !stored.deletedAt.IsZero() {
+		return sql.ErrNoRows
+	}
+
+	updated, err := repo.newFilmRow(film)
+	if err != nil {
+		return err
+	}
+	updated.ID = film.ID
+	if err := updated.check(); err != nil {
+		return err
+	}
+
+	if err := repo.checkCast(film.Actors); err != nil {
+		return err
+	}
+
+	repo.films[film.ID] = updated
+	repo.deleteActors(film.ID)
+	repo.insertActors(film.ID, film.Actors)
+
+	return nil
+}
+
+func (repo *ItemMapRepository) UpdateColumnFilm(film Film, columnName string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.films[film.ID]
+	if !ok || !stored.deletedAt.IsZero() {
+		return sql.ErrNoRows
+	}
+
+	updated := *stored
+	switch columnName {
+	case "Name":
+		updated.Name = film.Name
+	case "Description":
+		updated.Description = film.Description
+	case "Date":
+		date, err := toNullInt(film.Date)
+		if err != nil {
+			return err
+		}
+		updated.Date = date
+	case "Rating":
+		rating, err := toNullInt(film.Rating)
+		if err != nil {
+			return err
+		}
+		updated.Rating = rating
+	default:
+		return errors.New(errs.WrongColumnError)
+	}
+
+	if err := updated.check(); err != nil {
+		return err
+	}
+
+	*stored = updated
+	return nil
+}
+
+// SearchFilm matches films whose name, description or cast contains every
+// word of the query. It ranks them like the Postgres search does, without
+// stemming. Names written in the other alphabet match by search key and go
+// last.
+func (repo *ItemMapRepository) SearchFilm(searchQuery string) ([]FoundFilm, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	words := strings.Fields(strings.ToLower(searchQuery))
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	pattern := searchKeyPattern(searchQuery)
+
+	var films []FoundFilm
+	ranks := make(map[uint32]float64)
+	for _, film := range repo.aliveFilms() {
+		var names []string
+		for _, actor := range repo.actorsByFilm(film.ID) {
+			names = append(names, actor.Name)
+		}
+		castNames := strings.Join(names, ", ")
+
+		var rank float64
+		for _, word := range words {
+			found := false
+			for _, part := range []struct {
+				text   string
+				weight float64
+			}{
+				{film.Name, 1.0},
+				{castNames, 0.4},
+				{film.Description, 0.2},
+			} {
+				if strings.Contains(strings.ToLower(part.text), word) {
+					rank += part.weight
+					found = true
+				}
+			}
+			if !found {
+				rank = 0
+				break
+			}
+		}
+		if rank == 0 && !matchKey(pattern, append(names, film.Name)...) {
+			continue
+		}
+
+		var parts []string
+		for _, part := range []string{film.Name, film.Description, castNames} {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		ranks[film.ID] = rank
+		films = append(films, FoundFilm{Film: film, Snippet: highlight(strings.Join(parts, ". "), words)})
+	}
+
+	sort.SliceStable(films, func(i, j int) bool {
+		return ranks[films[i].ID] > ranks[films[j].ID]
+	})
+
+	return films, nil
+}
+
+// Suggest offers film and actor names that start with query, then names
+// with a word starting with it, then names containing it. The score grows
+// with the share of the name the query covers.
+func (repo *ItemMapRepository) Suggest(ctx context.Context, query string, limit int) ([]Suggestion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	score := func(name string) float64 {
+		lower := strings.ToLower(name)
+		if lower == "" {
+			return 0
+		}
+		coverage := float64(len(query)) / float64(len(lower))
+		switch {
+		case strings.HasPrefix(lower, query):
+			return 1 + coverage
+		case strings.Contains(lower, " "+query):
+			return 0.5 + coverage/2
+		case strings.Contains(lower, query):
+			return coverage / 2
+		default:
+			return 0
+		}
+	}
+
+	var suggestions []Suggestion
+	for _, film := range repo.aliveFilms() {
+		if s := score(film.Name); s > 0 {
+			suggestions = append(suggestions, Suggestion{Type: SuggestFilm, ID: film.ID, Name: film.Name, Score: s})
+		}
+	}
+	for _, actor := range repo.aliveActors() {
+		if s := score(actor.Name); s > 0 {
+			suggestions = append(suggestions, Suggestion{Type: SuggestActor, ID: actor.ID, Name: actor.Name, Score: s})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Name < suggestions[j].Name
+	})
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions, nil
+}
+
+func (repo *ItemMapRepository) FuzzySearchFilm(searchQuery string, threshold float64) ([]FoundFilm, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var films []FoundFilm
+	for _, film := range repo.aliveFilms() {
+		score := wordSimilarity(searchQuery, film.Name)
+		if score > 0 && score >= threshold {
+			films = append(films, FoundFilm{Film: film, Score: score})
+		}
+	}
+
+	sort.SliceStable(films, func(i, j int) bool {
+		return films[i].Score > films[j].Score
+	})
+
+	return films, nil
+}
+
+// QueryFilms finds the films matching a search language query, ordered by
+// id. Free text terms match like SearchFilm does.
+func (repo *ItemMapRepository) QueryFilms(query filmql.Node) ([]FoundFilm, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var films []FoundFilm
+	for _, film := range repo.aliveFilms() {
+		if repo.matchQuery(film, query) {
+			films = append(films, FoundFilm{Film: film})
+		}
+	}
+
+	sort.Slice(films, func(i, j int) bool {
+		return films[i].ID < films[j].ID
+	})
+
+	return films, nil
+}
+
+// FilmFacets counts the facets of the films GetFilms returns for filter,
+// across all pages.
+func (repo *ItemMapRepository) FilmFacets(filter FilmFilter, topActors int) (Facets, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var films []Film
+	for _, film := range repo.aliveFilms() {
+		if repo.matchFilm(film, filter) {
+			films = append(films, film)
+		}
+	}
+
+	return repo.facets(films, topActors), nil
+}
+
+// FilmFacetsByIDs counts the facets of the given films, e.g. search results.
+func (repo *ItemMapRepository) FilmFacetsByIDs(ids []uint32, topActors int) (Facets, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	wanted := distinctIDs(ids)
+
+	var films []Film
+	for _, film := range repo.aliveFilms() {
+		if _, ok := wanted[film.ID]; ok {
+			films = append(films, film)
+		}
+	}
+
+	return repo.facets(films, topActors), nil
+}
+
+func (repo *ItemMapRepository) facets(films []Film, topActors int) Facets {
+	decades := make(map[int64]int)
+	ratings := make(map[int64]int)
+	actors := make(map[uint32]*ActorFacet)
+	for _, film := range films {
+		if date, ok := film.Date.(int64); ok {
+			decades[date/10*10]++
+		}
+		if rating, ok := film.Rating.(int64); ok {
+			ratings[ratingBucket(rating)]++
+		}
+		for _, actor := range repo.actorsByFilm(film.ID) {
+			if actors[actor.ID] == nil {
+				actors[actor.ID] = &ActorFacet{ID: actor.ID, Name: actor.Name}
+			}
+			actors[actor.ID].Count++
+		}
+	}
+
+	facets := newFacets()
+	for decade, count := range decades {
+		facets.Decades = append(facets.Decades, DecadeFacet{Decade: decade, Count: count})
+	}
+	for bucket, count := range ratings {
+		facets.Ratings = append(facets.Ratings, ratingFacet(bucket, count))
+	}
+	for _, actor := range actors {
+		facets.Actors = append(facets.Actors, *actor)
+	}
+
+	sortFacets(&facets)
+	if len(facets.Actors) > topActors {
+		facets.Actors = facets.Actors[:topActors]
+	}
+
+	return facets
+}
+
+func (repo *ItemMapRepository) DeleteActors(filmID uint32) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.deleteActors(filmID)
+	return nil
+}
+
+func (repo *ItemMapRepository) InsertActors(filmID uint32, actors []Actor) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.films[filmID]; !ok {
+		return errors.New(errs.FilmNotExist)
+	}
+
+	if err := repo.checkCast(actors); err != nil {
+		return err
+	}
+
+	for _, actor := range actors {
+		if _, ok := repo.filmActors[filmActorKey{filmID, actor.ID}]; ok {
+			return errors.New(errs.DuplicateCastError)
+		}
+	}
+
+	repo.insertActors(filmID, actors)
+	return nil
+}
+
+func (repo *ItemMapRepository) ReplaceActors(filmID uint32, actors []Actor) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.films[filmID]
+	if !ok || !stored.deletedAt.IsZero() {
+		return sql.ErrNoRows
+	}
+
+	if err := repo.checkCast(actors); err != nil {
+		return err
+	}
+
+	repo.deleteActors(filmID)
+	repo.insertActors(filmID, actors)
+	return nil
+}
+
+func (repo *ItemMapRepository) GetActorFilms(actor Actor) ([]Film, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	return repo.actorFilms(actor.ID), nil
+}
+
+func (repo *ItemMapRepository) DeleteFilm(id uint32) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.films[id]
+	if !ok || !stored.deletedAt.IsZero() {
+		return errors.New(errs.NotFound)
+	}
+
+	stored.deletedAt = time.Now()
+	return nil
+}
+
+func (repo *ItemMapRepository) RestoreFilm(id uint32) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.films[id]
+	if !ok || stored.deletedAt.IsZero() {
+		return errors.New(errs.NotFound)
+	}
+
+	stored.deletedAt = time.Time{}
+	return nil
+}
+
+func (repo *ItemMapRepository) CreateActor(actor Actor) (uint32, error) {
+	err := actor.Empty()
+	if err != nil {
+		return 0, err
+	}
+
+	date, err := toNullDate(actor.Date)
+	if err != nil {
+		return 0, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.lastActorID++
+	stored := &mapActor{Actor: Actor{
+		ID:     repo.lastActorID,
+		Name:   actor.Name,
+		Gender: actor.Gender,
+		Date:   date,
+	}}
+	repo.actors[stored.ID] = stored
+
+	return stored.ID, nil
+}
+
+func (repo *ItemMapRepository) GetActorByID(id uint32) (Actor, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	stored, ok := repo.actors[id]
+	if !ok || !stored.deletedAt.IsZero() {
+		return Actor{}, sql.ErrNoRows
+	}
+
+	actor := stored.Actor
+	actor.Films = repo.actorFilms(id)
+
+	return actor, nil
+}
+
+func (repo *ItemMapRepository) GetActors(page Page) ([]Actor, int, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	alive := repo.aliveActors()
+
+	var actors []Actor
+	for _, actor := range alive {
+		if page.After != nil && actor.ID <= page.After.ID {
+			continue
+		}
+		if page.Limit > 0 && len(actors) == page.Limit {
+			break
+		}
+
+		actor.Films = repo.actorFilms(actor.ID)
+		actors = append(actors, actor)
+	}
+
+	return actors, len(alive), nil
+}
+
+func (repo *ItemMapRepository) SearchActors(filter ActorFilter) ([]FoundActor, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	name := strings.ToLower(filter.Name)
+	pattern := searchKeyPattern(filter.Name)
+
+	var actors []FoundActor
+	for _, actor := range repo.aliveActors() {
+		if !strings.Contains(strings.ToLower(actor.Name), name) && !matchKey(pattern, actor.Name) {
+			continue
+		}
+		if filter.Gender != "" && !strings.EqualFold(actor.Gender, filter.Gender) {
+			continue
+		}
+
+		if filter.BornFrom != nil || filter.BornTo != nil {
+			date, ok := actor.Date.(time.Time)
+			if !ok || (filter.BornFrom != nil && date.Before(*filter.BornFrom)) || (filter.BornTo != nil && date.After(*filter.BornTo)) {
+				continue
+			}
+		}
+
+		actors = append(actors, FoundActor{Actor: actor, FilmCount: len(repo.actorFilms(actor.ID))})
+	}
+
+	sort.SliceStable(actors, func(i, j int) bool {
+		return actors[i].Name < actors[j].Name
+	})
+
+	return actors, nil
+}
+
+func (repo *ItemMapRepository) UpdateActor(actor Actor) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.actors[actor.ID]
+	if !ok || !stored.deletedAt.IsZero() {
+		return sql.ErrNoRows
+	}
+
+	err := actor.Empty()
+	if err != nil {
+		return err
+	}
+
+	date, err := toNullDate(actor.Date)
+	if err != nil {
+		return err
+	}
+
+	stored.Name = actor.Name
+	stored.Gender = actor.Gender
+	stored.Date = date
+
+	return nil
+}
+
+func (repo *ItemMapRepository) UpdateColumnActor(actor Actor, columnName string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.actors[actor.ID]
+	if !ok || !stored.deletedAt.IsZero() {
+		return sql.ErrNoRows
+	}
+
+	err := actor.Empty()
+	if err != nil {
+		return err
+	}
+
+	switch columnName {
+	case "Name":
+		stored.Name = actor.Name
+	case "Gender":
+		stored.Gender = actor.Gender
+	case "Date":
+		date, err := toNullDate(actor.Date)
+		if err != nil {
+			return err
+		}
+		stored.Date = date
+	default:
+		return errors.New(errs.WrongColumnError)
+	}
+
+	return nil
+}
+
+func (repo *ItemMapRepository) ActorsByFilm(film Film) ([]Actor, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	return repo.actorsByFilm(film.ID), nil
+}
+
+func (repo *ItemMapRepository) DeleteActor(id uint32) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.actors[id]
+	if !ok || !stored.deletedAt.IsZero() {
+		return errors.New(errs.NotFound)
+	}
+
+	stored.deletedAt = time.Now()
+	return nil
+}
+
+func (repo *ItemMapRepository) RestoreActor(id uint32) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.actors[id]
+	if !ok || stored.deletedAt.IsZero() {
+		return errors.New(errs.NotFound)
+	}
+
+	stored.deletedAt = time.Time{}
+	return nil
+}
+
+func (repo *ItemMapRepository) GetTrash() (Trash, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	trash := Trash{
+		Films:  []DeletedFilm{},
+		Actors: []DeletedActor{},
+	}
+
+	for _, stored := range repo.films {
+		if !stored.deletedAt.IsZero() {
+			trash.Films = append(trash.Films, DeletedFilm{Film: stored.Film, DeletedAt: stored.deletedAt})
+		}
+	}
+	sort.Slice(trash.Films, func(i, j int) bool {
+		return trash.Films[i].DeletedAt.After(trash.Films[j].DeletedAt)
+	})
+
+	for _, stored := range repo.actors {
+		if !stored.deletedAt.IsZero() {
+			trash.Actors = append(trash.Actors, DeletedActor{Actor: stored.Actor, DeletedAt: stored.deletedAt})
+		}
+	}
+	sort.Slice(trash.Actors, func(i, j int) bool {
+		return trash.Actors[i].DeletedAt.After(trash.Actors[j].DeletedAt)
+	})
+
+	return trash, nil
+}
+
+func (repo *ItemMapRepository) PurgeTrash(olderThan time.Duration) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	deadline := time.Now().Add(-olderThan)
+
+	purgedFilms := make(map[uint32]struct{})
+	for id, stored := range repo.films {
+		if !stored.deletedAt.IsZero() && stored.deletedAt.Before(deadline) {
+			delete(repo.films, id)
+			purgedFilms[id] = struct{}{}
+		}
+	}
+
+	purgedActors := make(map[uint32]struct{})
+	for id, stored := range repo.actors {
+		if !stored.deletedAt.IsZero() && stored.deletedAt.Before(deadline) {
+			delete(repo.actors, id)
+			purgedActors[id] = struct{}{}
+		}
+	}
+
+	for key := range repo.filmActors {
+		_, filmPurged := purgedFilms[key.filmID]
+		_, actorPurged := purgedActors[key.actorID]
+		if filmPurged || actorPurged {
+			delete(repo.filmActors, key)
+		}
+	}
+
+	return int64(len(purgedFilms) + len(purgedActors)), nil
+}
+
+func (repo *ItemMapRepository) newFilmRow(film Film) (*mapFilm, error) {
+	date, err := toNullInt(film.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	rating, err := toNullInt(film.Rating)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mapFilm{Film: Film{
+		Name:        film.Name,
+		Description: film.Description,
+		Date:        date,
+		Rating:      rating,
+	}}, nil
+}
+
+func (repo *ItemMapRepository) deleteActors(filmID uint32) {
+	for key := range repo.filmActors {
+		if key.filmID == filmID {
+			delete(repo.filmActors, key)
+		}
+	}
+}
+
+func (repo *ItemMapRepository) insertActors(filmID uint32, actors []Actor) {
+	for _, actor := range actors {
+		repo.filmActors[filmActorKey{filmID, actor.ID}] = struct{}{}
+	}
+}
+
+func (repo *ItemMapRepository) aliveFilms() []Film {
+	var films []Film
+	for _, stored := range repo.films {
+		if stored.deletedAt.IsZero() {
+			films = append(films, stored.Film)
+		}
+	}
+
+	sort.Slice(films, func(i, j int) bool { return films[i].ID < films[j].ID })
+	return films
+}
+
+func (repo *ItemMapRepository) aliveActors() []Actor {
+	var actors []Actor
+	for _, stored := range repo.actors {
+		if stored.deletedAt.IsZero() {
+			actors = append(actors, stored.Actor)
+		}
+	}
+
+	sort.Slice(actors, func(i, j int) bool { return actors[i].ID < actors[j].ID })
+	return actors
+}
+
+func (repo *ItemMapRepository) actorsByFilm(filmID uint32) []Actor {
+	var actors []Actor
+	for _, actor := range repo.aliveActors() {
+		if _, ok := repo.filmActors[filmActorKey{filmID, actor.ID}]; ok {
+			actors = append(actors, actor)
+		}
+	}
+
+	return actors
+}
+
+func (repo *ItemMapRepository) actorFilms(actorID uint32) []Film {
+	var films []Film
+	for _, film := range repo.aliveFilms() {
+		if _, ok := repo.filmActors[filmActorKey{film.ID, actorID}]; ok {
+			films = append(films, film)
+		}
+	}
+
+	return films
+}
+
+// matchFilm applies a FilmFilter the way filmsWhere does in SQL.
+func (repo *ItemMapRepository) matchFilm(film Film, filter FilmFilter) bool {
+	inRange := func(value interface{}, from, to *int64) bool {
+		if from == nil && to == nil {
+			return true
+		}
+		n, ok := value.(int64)
+		return ok && (from == nil || n >= *from) && (to == nil || n <= *to)
+	}
+
+	if !inRange(film.Date, filter.DateFrom, filter.DateTo) || !inRange(film.Rating, filter.RatingFrom, filter.RatingTo) {
+		return false
+	}
+
+	if !strings.HasPrefix(strings.ToLower(film.Name), strings.ToLower(filter.NamePrefix)) {
+		return false
+	}
+
+	if len(filter.ActorIDs) == 0 {
+		return true
+	}
+
+	for id := range distinctIDs(filter.ActorIDs) {
+		_, ok := repo.filmActors[filmActorKey{film.ID, id}]
+		if ok && filter.AnyActor {
+			return true
+		}
+		if !ok && !filter.AnyActor {
+			return false
+		}
+	}
+
+	return !filter.AnyActor
+}
+
+func (film *mapFilm) check() error {
+	if date, ok := film.Date.(int64); ok && (date < 1900 || date > 2200) {
+		return errors.New(errs.FilmDateError)
+	}
+
+	if rating, ok := film.Rating.(int64); ok && (rating < 0 || rating > 10) {
+		return errors.New(errs.FilmRatingError)
+	}
+
+	return nil
+}
+
+// checkCast mirrors the film_actor constraints: every actor exists, even if
+// it is in the trash, and appears in the cast once.
+func (repo *ItemMapRepository) checkCast(actors []Actor) error {
+	seen := make(map[uint32]struct{}, len(actors))
+	for _, actor := range actors {
+		if _, ok := repo.actors[actor.ID]; !ok {
+			return errors.New(errs.ActorNotExist)
+		}
+		if _, ok := seen[actor.ID]; ok {
+			return errors.New(errs.DuplicateCastError)
+		}
+		seen[actor.ID] = struct{}{}
+	}
+
+	return nil
+}
+
+// matchQuery evaluates a search language query on film the way the
+// condition filmql.SQL compiles it to does.
+func (repo *ItemMapRepository) matchQuery(film Film, query filmql.Node) bool {
+	switch node := query.(type) {
+	case filmql.And:
+		for _, n := range node.Nodes {
+			if !repo.matchQuery(film, n) {
+				return false
+			}
+		}
+		return true
+	case filmql.Or:
+		for _, n := range node.Nodes {
+			if repo.matchQuery(film, n) {
+				return true
+			}
+		}
+		return false
+	case filmql.Not:
+		return !repo.matchQuery(film, node.Node)
+	case filmql.Text:
+		var names []string
+		for _, actor := range repo.actorsByFilm(film.ID) {
+			names = append(names, actor.Name)
+		}
+		text := strings.ToLower(strings.Join(append(names, film.Name, film.Description), " "))
+		for _, word := range strings.Fields(strings.ToLower(node.Text)) {
+			if !strings.Contains(text, word) {
+				return false
+			}
+		}
+		return true
+	case filmql.Match:
+		return repo.matchField(film, node)
+	default:
+		return false
+	}
+}
+
+func (repo *ItemMapRepository) matchField(film Film, match filmql.Match) bool {
+	if match.Field.Numeric() {
+		value := film.Date
+		if match.Field == filmql.FieldRating {
+			value = film.Rating
+		}
+		n, ok := value.(int64)
+		if !ok {
+			return false
+		}
+
+		switch match.Op {
+		case filmql.OpGreater:
+			return n > match.Number
+		case filmql.OpGreaterEqual:
+			return n >= match.Number
+		case filmql.OpLess:
+			return n < match.Number
+		case filmql.OpLessEqual:
+			return n <= match.Number
+		default:
+			return n == match.Number
+		}
+	}
+
+	texts := []string{film.Name}
+	switch match.Field {
+	case filmql.FieldDescription:
+		texts = []string{film.Description}
+	case filmql.FieldActor:
+		texts = nil
+		for _, actor := range repo.actorsByFilm(film.ID) {
+			texts = append(texts, actor.Name)
+		}
+	}
+
+	value := strings.ToLower(match.Text)
+	for _, text := range texts {
+		text = strings.ToLower(text)
+		if (match.Op == filmql.OpEqual && text == value) || (match.Op == filmql.OpContains && strings.Contains(text, value)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchKey reports whether the search key of any of names matches pattern
+// the way LIKE does on the search_key columns.
+func matchKey(pattern sql.NullString, names ...string) bool {
+	if !pattern.Valid {
+		return false
+	}
+
+	key := strings.Trim(pattern.String, "%")
+	for _, name := range names {
+		if strings.Contains(translit.Normalize(name), key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// highlight wraps every occurrence of the lower-cased words in <b></b>.
+func highlight(text string, words []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		return text
+	}
+
+	marked := make([]bool, len(text))
+	for _, word := range words {
+		for start := 0; ; {
+			i := strings.Index(lower[start:], word)
+			if i < 0 {
+				break
+			}
+			for k := start + i; k < start+i+len(word); k++ {
+				marked[k] = true
+			}
+			start += i + len(word)
+		}
+	}
+
+	var b strings.Builder
+	for i := range text {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString("<b>")
+		}
+		b.WriteByte(text[i])
+		if marked[i] && (i == len(text)-1 || !marked[i+1]) {
+			b.WriteString("</b>")
+		}
+	}
+
+	return b.String()
+}
+
+// compareFilms orders films the way Postgres does: NULL is greater than any value.
+func compareFilms(a, b Film, field string) (int, error) {
+	switch field {
+	case "name":
+		return strings.Compare(a.Name, b.Name), nil
+	case "date":
+		return compareNullInt(a.Date, b.Date), nil
+	case "rating":
+		return compareNullInt(a.Rating, b.Rating), nil
+	default:
+		return 0, fmt.Errorf("column \"%s\" does not exist", field)
+	}
+}
+
+// cursorFilm builds a film holding the cursor sort key.
+func cursorFilm(field string, after *Cursor) (Film, error) {
+	film := Film{ID: after.ID}
+
+	switch field {
+	case "name":
+		name, ok := after.Value.(string)
+		if !ok {
+			return Film{}, fmt.Errorf("invalid cursor value %v", after.Value)
+		}
+		film.Name = name
+	case "date", "rating":
+		value, err := toNullInt(after.Value)
+		if err != nil {
+			return Film{}, err
+		}
+		film.Date, film.Rating = value, value
+	}
+
+	return film, nil
+}
+
+func compareIDs(a, b uint32) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareNullInt(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	x, y := a.(int64), b.(int64)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toNullInt(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint32:
+		return int64(v), nil
+	case float64:
+		if v != float64(int64(v)) {
+			return nil, fmt.Errorf("invalid input syntax for type integer: \"%v\"", v)
+		}
+		return int64(v), nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input syntax for type integer: \"%s\"", v)
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+// toNullDate follows CreateActor: anything but a non-empty string is stored as NULL.
+func toNullDate(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+
+		for _, layout := range actorDateLayouts {
+			if date, err := time.Parse(layout, v); err == nil {
+				return date, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid input syntax for type date: \"%s\"", v)
+	default:
+		return nil, nil
+	}
+}
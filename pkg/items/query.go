@@ -0,0 +1,59 @@
+package items
+
+import (
+	"database/sql"
+	"filmlibrary/pkg/translit"
+	"fmt"
+	"strings"
+)
+
+// whereClause collects the conditions of a query. Conditions are written
+// with ? placeholders that are numbered as they are added, so values are
+// always passed as arguments and never end up in the SQL text.
+type whereClause struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (w *whereClause) add(condition string, args ...interface{}) {
+	for _, arg := range args {
+		w.args = append(w.args, arg)
+		condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(w.args)), 1)
+	}
+
+	w.conditions = append(w.conditions, condition)
+}
+
+// placeholder reserves the next argument number for a clause outside WHERE, e.g. LIMIT.
+func (w *whereClause) placeholder(arg interface{}) string {
+	w.args = append(w.args, arg)
+	return fmt.Sprintf("$%d", len(w.args))
+}
+
+func (w *whereClause) String() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(w.conditions, " AND ")
+}
+
+func distinctIDs(ids []uint32) map[uint32]struct{} {
+	set := make(map[uint32]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	return set
+}
+
+// searchKeyPattern is the LIKE pattern matching search keys that contain the
+// key of query. It is NULL, matching nothing, for keys too short to search by.
+func searchKeyPattern(query string) sql.NullString {
+	key := translit.Normalize(query)
+	if len(key) < translit.MinKeyLen {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: "%" + key + "%", Valid: true}
+}
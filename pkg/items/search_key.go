@@ -0,0 +1,64 @@
+package items
+
+import (
+	"filmlibrary/pkg/translit"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// FillSearchKeys computes the search keys of films and actors that have
+// none yet, e.g. rows written before the search_key columns existed.
+func (repo *ItemMemoryRepository) FillSearchKeys() (int64, error) {
+	var filled int64
+	err := repo.inTx(func(q Querier) error {
+		for _, table := range []string{"films", "actors"} {
+			rows, err := q.Query(fmt.Sprintf("SELECT id, coalesce(name, '') FROM %s WHERE search_key IS NULL", table))
+			if err != nil {
+				return err
+			}
+
+			var ids pq.Int64Array
+			var keys pq.StringArray
+			for rows.Next() {
+				var id int64
+				var name string
+				if err := rows.Scan(&id, &name); err != nil {
+					rows.Close()
+					return err
+				}
+				ids = append(ids, id)
+				keys = append(keys, translit.Normalize(name))
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			if len(ids) == 0 {
+				continue
+			}
+
+			result, err := q.Exec(fmt.Sprintf(`
+                UPDATE %s SET search_key = keys.key
+                FROM unnest($1::int[], $2::text[]) AS keys(id, key)
+                WHERE %[1]s.id = keys.id`, table), ids, keys)
+			if err != nil {
+				return err
+			}
+
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			filled += affected
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return filled, nil
+}
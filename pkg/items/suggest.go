@@ -0,0 +1,42 @@
+package items
+
+import (
+	"context"
+	"filmlibrary/pkg/like"
+	"strings"
+)
+
+// Suggest offers up to limit film and actor names that start with query or
+// contain a word similar to it. Prefix matches go first.
+func (repo *ItemMemoryRepository) Suggest(ctx context.Context, query string, limit int) ([]Suggestion, error) {
+	prefix := like.Escape(strings.ToLower(query)) + "%"
+
+	rows, err := repo.DB.QueryContext(ctx, `
+        (SELECT 'film', id, name, (lower(name) LIKE $2)::int + word_similarity(lower($1), lower(name)) AS score
+        FROM films
+        WHERE deleted_at IS NULL AND (lower(name) LIKE $2 OR lower($1) <% lower(name))
+        ORDER BY score DESC, name LIMIT $3)
+        UNION ALL
+        (SELECT 'actor', id, name, (lower(name) LIKE $2)::int + word_similarity(lower($1), lower(name)) AS score
+        FROM actors
+        WHERE deleted_at IS NULL AND (lower(name) LIKE $2 OR lower($1) <% lower(name))
+        ORDER BY score DESC, name LIMIT $3)
+        ORDER BY score DESC, name
+        LIMIT $3`, query, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suggestions []Suggestion
+	for rows.Next() {
+		var suggestion Suggestion
+		err := rows.Scan(&suggestion.Type, &suggestion.ID, &suggestion.Name, &suggestion.Score)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	return suggestions, rows.Err()
+}
@@ -0,0 +1,75 @@
+package items
+
+import (
+	"time"
+)
+
+func (repo *ItemMemoryRepository) GetTrash() (Trash, error) {
+	trash := Trash{
+		Films:  []DeletedFilm{},
+		Actors: []DeletedActor{},
+	}
+
+	filmRows, err := repo.DB.Query("SELECT id, name, description, date, rating, deleted_at FROM films WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC")
+	if err != nil {
+		return Trash{}, err
+	}
+	defer filmRows.Close()
+
+	for filmRows.Next() {
+		var film DeletedFilm
+		err := filmRows.Scan(&film.ID, &film.Name, &film.Description, &film.Date, &film.Rating, &film.DeletedAt)
+		if err != nil {
+			return Trash{}, err
+		}
+		trash.Films = append(trash.Films, film)
+	}
+
+	actorRows, err := repo.DB.Query("SELECT id, name, gender, date, deleted_at FROM actors WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC")
+	if err != nil {
+		return Trash{}, err
+	}
+	defer actorRows.Close()
+
+	for actorRows.Next() {
+		var actor DeletedActor
+		err := actorRows.Scan(&actor.ID, &actor.Name, &actor.Gender, &actor.Date, &actor.DeletedAt)
+		if err != nil {
+			return Trash{}, err
+		}
+		trash.Actors = append(trash.Actors, actor)
+	}
+
+	return trash, nil
+}
+
+func (repo *ItemMemoryRepository) PurgeTrash(olderThan time.Duration) (int64, error) {
+	age := olderThan.Seconds()
+
+	var purged int64
+	err := repo.inTx(func(q Querier) error {
+		// film_actor rows of purged films and actors go with them by cascade.
+		for _, query := range []string{
+			"DELETE FROM films WHERE deleted_at < now() - make_interval(secs => $1)",
+			"DELETE FROM actors WHERE deleted_at < now() - make_interval(secs => $1)",
+		} {
+			result, err := q.Exec(query, age)
+			if err != nil {
+				return err
+			}
+
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			purged += affected
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
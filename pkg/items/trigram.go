@@ -0,0 +1,48 @@
+package items
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// trigrams splits text into words and returns the set of their trigrams,
+// padded the way pg_trgm pads them: two spaces before a word, one after.
+func trigrams(text string) map[string]struct{} {
+	set := make(map[string]struct{})
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, word := range words {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = struct{}{}
+		}
+	}
+
+	return set
+}
+
+// wordSimilarity approximates pg_trgm word_similarity: the share of the
+// query trigrams found in text, rounded like the Postgres score.
+func wordSimilarity(query, text string) float64 {
+	tq, tt := trigrams(query), trigrams(text)
+	if len(tq) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for trigram := range tq {
+		if _, ok := tt[trigram]; ok {
+			shared++
+		}
+	}
+
+	return roundScore(float64(shared) / float64(len(tq)))
+}
+
+// roundScore keeps three decimals of a similarity score.
+func roundScore(score float64) float64 {
+	return math.Round(score*1000) / 1000
+}
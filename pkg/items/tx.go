@@ -0,0 +1,31 @@
+package items
+
+import (
+	"database/sql"
+)
+
+// Querier is the part of *sql.DB and *sql.Tx the repository needs, so the
+// same statements run either on their own or inside a unit of work.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// inTx runs fn as one unit of work: every statement fn issues through q is
+// committed together, or rolled back if fn returns an error or panics.
+func (repo *ItemMemoryRepository) inTx(fn func(q Querier) error) error {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
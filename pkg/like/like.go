@@ -0,0 +1,12 @@
+// Package like builds LIKE patterns out of user supplied values.
+package like
+
+import "strings"
+
+var escaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Escape escapes the LIKE wildcards of str, for patterns written with
+// ESCAPE '\'.
+func Escape(str string) string {
+	return escaper.Replace(str)
+}
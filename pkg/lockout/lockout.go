@@ -0,0 +1,172 @@
+package lockout
+
+import (
+	"filmlibrary/pkg/config"
+	"filmlibrary/pkg/users"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Guard slows down password guessing. Failed logins are counted per
+// username and per client IP: past the free failures every failure doubles
+// the wait before the next attempt, and too many lock the key out.
+//
+// A login counts as failed from the moment it begins, so that parallel
+// guesses cannot all slip through before the first one fails; Succeeded
+// and Release give the attempt back.
+type Guard struct {
+	repo   users.AttemptRepo
+	cfg    config.Lockout
+	logger *zap.SugaredLogger
+
+	mu     sync.Mutex
+	pruned time.Time
+}
+
+// limits are the free and the maximal failures of a kind of key.
+type limits struct {
+	free, max int
+}
+
+// pruneEvery is how often Begin forgets the attempts past the window.
+const pruneEvery = time.Minute
+
+func NewGuard(repo users.AttemptRepo, cfg config.Lockout, logger *zap.SugaredLogger) *Guard {
+	return &Guard{repo: repo, cfg: cfg, logger: logger}
+}
+
+// Begin starts a login for username from ip. It returns how long the login
+// has to wait, counting nothing, or zero and counts the login as failed
+// until Succeeded or Release.
+func (g *Guard) Begin(username, ip string, now time.Time) (time.Duration, error) {
+	g.prune(now)
+
+	kinds := []limits{
+		{g.cfg.FreeFailures, g.cfg.MaxFailures},
+		{g.cfg.FreeFailuresIP, g.cfg.MaxFailuresIP},
+	}
+
+	var wait time.Duration
+	var locked []users.LoginAttempt
+	err := g.repo.UpdateLogins([]string{userKey(username), ipKey(ip)}, func(attempts []*users.LoginAttempt) {
+		for _, attempt := range attempts {
+			if left := attempt.BlockedUntil.Sub(now); left > wait {
+				wait = left
+			}
+		}
+		if wait > 0 {
+			return
+		}
+
+		for i, attempt := range attempts {
+			// a served lockout and failures past the window start the count over
+			if attempt.Locked || !attempt.LastFailure.After(now.Add(-g.cfg.Window)) {
+				*attempt = users.LoginAttempt{Key: attempt.Key}
+			}
+			attempt.Failures++
+			attempt.LastFailure = now
+
+			switch limit := kinds[i]; {
+			case attempt.Failures >= limit.max:
+				attempt.BlockedUntil, attempt.Locked = now.Add(g.cfg.Duration), true
+				locked = append(locked, *attempt)
+			case attempt.Failures > limit.free:
+				attempt.BlockedUntil = now.Add(g.backoff(attempt.Failures - limit.free))
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, attempt := range locked {
+		g.logger.Warnw("audit: login locked out",
+			"key", attempt.Key,
+			"failures", attempt.Failures,
+			"until", attempt.BlockedUntil,
+		)
+	}
+
+	return wait, nil
+}
+
+// Succeeded forgets the failures of username and gives back the attempt of
+// ip. The other failures of the IP stay: one account of the attacker must
+// not clear the way to guess others.
+func (g *Guard) Succeeded(username, ip string) error {
+	return g.repo.UpdateLogins([]string{userKey(username), ipKey(ip)}, func(attempts []*users.LoginAttempt) {
+		*attempts[0] = users.LoginAttempt{Key: attempts[0].Key}
+		giveBack(attempts[1])
+	})
+}
+
+// Release gives back the attempt of a login that ended before the password
+// turned out wrong.
+func (g *Guard) Release(username, ip string) error {
+	return g.repo.UpdateLogins([]string{userKey(username), ipKey(ip)}, func(attempts []*users.LoginAttempt) {
+		for _, attempt := range attempts {
+			giveBack(attempt)
+		}
+	})
+}
+
+// Unlock lifts the lockout and backoff of username.
+func (g *Guard) Unlock(username string) error {
+	return g.repo.ResetLogin(userKey(username))
+}
+
+// giveBack uncounts an attempt. A block it caused stays, a parallel login
+// may have been turned away by it already.
+func giveBack(attempt *users.LoginAttempt) {
+	if attempt.Failures > 0 {
+		attempt.Failures--
+	}
+}
+
+// prune forgets the attempts of keys quiet for the whole window, at most
+// once every pruneEvery.
+func (g *Guard) prune(now time.Time) {
+	g.mu.Lock()
+	if now.Sub(g.pruned) < pruneEvery {
+		g.mu.Unlock()
+		return
+	}
+	g.pruned = now
+	g.mu.Unlock()
+
+	if err := g.repo.PruneLogins(now.Add(-g.cfg.Window), now); err != nil {
+		g.logger.Errorf("pruning login attempts: %v", err)
+	}
+}
+
+// backoff doubles the wait with every failure past the free ones.
+func (g *Guard) backoff(over int) time.Duration {
+	wait := g.cfg.Backoff
+	for i := 1; i < over && wait < g.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > g.cfg.MaxBackoff {
+		wait = g.cfg.MaxBackoff
+	}
+
+	return wait
+}
+
+// maxKeyUsernameLen keeps keys of made up, overlong usernames within
+// login_attempts.key. No real username is that long.
+const maxKeyUsernameLen = 100
+
+func userKey(username string) string {
+	name := []rune(strings.ToLower(username))
+	if len(name) > maxKeyUsernameLen {
+		name = name[:maxKeyUsernameLen]
+	}
+	return "user:" + string(name)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
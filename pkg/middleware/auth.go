@@ -14,11 +14,12 @@ var (
 	noAuthUrls = map[string]struct{}{
 		"/api/login":          {},
 		"/api/register":       {},
+		"/api/token/refresh":  {},
 		"/swagger/index.html": {},
 	}
 )
 
-func Auth(logger *zap.SugaredLogger, next http.Handler, repo *users.UserMemoryRepository) http.Handler {
+func Auth(logger *zap.SugaredLogger, next http.Handler, repo users.UserRepo, keys *session.Keys) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.Info("Authentication middleware",
 			zap.String("method", r.Method),
@@ -34,15 +35,11 @@ func Auth(logger *zap.SugaredLogger, next http.Handler, repo *users.UserMemoryRe
 			return
 		}
 
-		myUser, err := session.GetUser(r.Header.Get("Authorization"), repo)
+		myUser, err := keys.GetUser(r.Header.Get("Authorization"), repo)
 		if err != nil {
 			http.Redirect(w, r, "/", http.StatusForbidden)
 			return
 		}
-		if myUser.Role != "admin" && r.Method == http.MethodPost {
-			http.Redirect(w, r, "/", http.StatusForbidden)
-			return
-		}
 
 		ctx := users.ContextWithUser(r.Context(), myUser)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+
+	"filmlibrary/pkg/access"
+	"filmlibrary/pkg/users"
+
+	"go.uber.org/zap"
+)
+
+// Authorize passes requests on to next when the role of the user Auth put
+// in the context holds perm. Signed out requests without it get 401,
+// signed in ones 403.
+func Authorize(logger *zap.SugaredLogger, policy *access.Policy, perm access.Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := access.Guest
+		user, ok := users.UserFromContext(r.Context())
+		if ok && user.Login != "" {
+			role = access.Role(user.Role)
+		}
+
+		if policy.Allows(role, perm) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger.Infow("Permission denied",
+			"role", role,
+			"permission", perm,
+			"url", r.URL.Path,
+		)
+
+		if role == access.Guest {
+			http.Redirect(w, r, "/", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusForbidden)
+	})
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"filmlibrary/pkg/access"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/ratelimit"
+	"filmlibrary/pkg/session"
+	"filmlibrary/pkg/users"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// RateLimit passes requests on to router while the client has requests
+// left in limiter, others get 429. Clients are the users Auth put in the
+// context, or the IPs of signed out requests. It wraps the whole router so
+// that requests matching no route draw from the client's bucket too.
+func RateLimit(logger *zap.SugaredLogger, limiter *ratelimit.Limiter, router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, role := "ip:"+session.ClientIP(r), access.Guest
+		user, ok := users.UserFromContext(r.Context())
+		if ok && user.Login != "" {
+			client, role = fmt.Sprintf("user:%d", user.ID), access.Role(user.Role)
+		}
+
+		var route string
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			route, _ = match.Route.GetPathTemplate()
+		}
+
+		result := limiter.Allow(client, role, route, time.Now())
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", seconds(result.Reset))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", result.Limit, seconds(limiter.Period())))
+
+		if result.Allowed {
+			router.ServeHTTP(w, r)
+			return
+		}
+
+		logger.Infow("Rate limit exceeded",
+			"client", client,
+			"route", route,
+			"url", r.URL.Path,
+		)
+
+		w.Header().Set("Retry-After", seconds(result.RetryAfter))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusTooManyRequests)
+		// the body of handlers.ErrorResponse
+		err := json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+		}{errs.TooManyRequests})
+		if err != nil {
+			logger.Error(err)
+		}
+	})
+}
+
+// seconds formats d as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,360 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockKey identifies the advisory lock held while migrations run, so two
+// instances starting at once never apply the same migration twice.
+const lockKey = 7385211
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrSchemaBehind is returned by CheckCurrent when migrations are pending.
+var ErrSchemaBehind = errors.New("database schema is behind, run migrate up")
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   uint
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// New reads NNNNNN_name.up.sql and NNNNNN_name.down.sql pairs from fsys.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("migration %s: bad version", entry.Name())
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(".", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[m.Version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d: names %s and %s differ", m.Version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrator := &Migrator{DB: db}
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d: up and down files are required", m.Version)
+		}
+		migrator.Migrations = append(migrator.Migrations, *m)
+	}
+
+	sort.Slice(migrator.Migrations, func(i, j int) bool {
+		return migrator.Migrations[i].Version < migrator.Migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+// Latest is the version the embedded migrations bring the schema to.
+func (m *Migrator) Latest() uint {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Current is the highest applied version, 0 for an empty database.
+func (m *Migrator) Current() (uint, error) {
+	var version uint
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		version = highest(applied)
+		return nil
+	})
+
+	return version, err
+}
+
+// CheckCurrent fails unless every embedded migration has been applied.
+func (m *Migrator) CheckCurrent() error {
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+
+	if current < m.Latest() {
+		return fmt.Errorf("%w: version %d, want %d", ErrSchemaBehind, current, m.Latest())
+	}
+
+	return nil
+}
+
+func (m *Migrator) Status() ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up() error {
+	return m.Goto(m.Latest())
+}
+
+// Down rolls back the last applied migration.
+func (m *Migrator) Down() error {
+	return m.withLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		current := highest(applied)
+		if current == 0 {
+			return nil
+		}
+
+		var target uint
+		for _, migration := range m.Migrations {
+			if _, ok := applied[migration.Version]; ok && migration.Version < current {
+				target = migration.Version
+			}
+		}
+
+		return m.migrate(conn, applied, target)
+	})
+}
+
+// Goto applies or rolls back migrations until version is the current one.
+func (m *Migrator) Goto(version uint) error {
+	if version != 0 && !m.has(version) {
+		return fmt.Errorf("migration %d does not exist", version)
+	}
+
+	return m.withLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		return m.migrate(conn, applied, version)
+	})
+}
+
+// Baseline records the migrations up to version as applied without running
+// them, for a database whose schema was created before it was versioned,
+// e.g. by the old initdb script, which matches version 1. It refuses
+// databases that already have applied migrations.
+func (m *Migrator) Baseline(version uint) error {
+	if !m.has(version) {
+		return fmt.Errorf("migration %d does not exist", version)
+	}
+
+	return m.withLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) != 0 {
+			return fmt.Errorf("schema is already at version %d, use goto", highest(applied))
+		}
+
+		ctx := context.Background()
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, migration := range m.Migrations {
+			if migration.Version > version {
+				break
+			}
+
+			_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", migration.Version)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+}
+
+func (m *Migrator) migrate(conn *sql.Conn, applied map[uint]time.Time, target uint) error {
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok || migration.Version <= target {
+			continue
+		}
+
+		err := run(conn, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		if err != nil {
+			return fmt.Errorf("migration %d down: %w", migration.Version, err)
+		}
+	}
+
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; ok || migration.Version > target {
+			continue
+		}
+
+		err := run(conn, migration.Up, "INSERT INTO schema_migrations (version) VALUES ($1)", migration.Version)
+		if err != nil {
+			return fmt.Errorf("migration %d up: %w", migration.Version, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) has(version uint) bool {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock.
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// run executes a migration script and records it in one transaction.
+func run(conn *sql.Conn, script, record string, version uint) error {
+	ctx := context.Background()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, record, version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func appliedVersions(conn *sql.Conn) (map[uint]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[uint]time.Time)
+	for rows.Next() {
+		var version uint
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func highest(applied map[uint]time.Time) uint {
+	var version uint
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+
+	return version
+}
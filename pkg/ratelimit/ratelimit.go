@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"filmlibrary/pkg/access"
+	"filmlibrary/pkg/config"
+)
+
+// Limiter keeps a token bucket per client and one per client and limited
+// route. A bucket holds up to its limit of requests and refills at the
+// limit per period; every request takes one request out of each bucket it
+// goes through.
+type Limiter struct {
+	cfg config.RateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// Result tells whether a request may go ahead and how the tightest bucket
+// it went through stands.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, zero when
+	// this one is.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	limit   int
+	tokens  float64
+	updated time.Time
+}
+
+func NewLimiter(cfg config.RateLimit) (*Limiter, error) {
+	for role := range cfg.Roles {
+		if role != string(access.Guest) && !access.Valid(access.Role(role)) {
+			return nil, fmt.Errorf("unknown role %q", role)
+		}
+	}
+
+	return &Limiter{
+		cfg:     cfg,
+		buckets: make(map[string]*bucket),
+	}, nil
+}
+
+// Allow takes a request of client with role to route out of its buckets.
+// Nothing is taken when one of them is empty.
+func (l *Limiter) Allow(client string, role access.Role, route string, now time.Time) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	limit, ok := l.cfg.Roles[string(role)]
+	if !ok {
+		limit = l.cfg.Requests
+	}
+	buckets := []*bucket{l.bucket(client, limit, now)}
+	if limit, ok := l.cfg.Routes[route]; ok {
+		buckets = append(buckets, l.bucket(client+" "+route, limit, now))
+	}
+
+	var blocked *bucket
+	for _, b := range buckets {
+		if b.tokens < 1 && (blocked == nil || l.retryAfter(b) > l.retryAfter(blocked)) {
+			blocked = b
+		}
+	}
+	if blocked != nil {
+		return Result{
+			Limit:      blocked.limit,
+			Reset:      l.reset(blocked),
+			RetryAfter: l.retryAfter(blocked),
+		}
+	}
+
+	tightest := buckets[0]
+	for _, b := range buckets {
+		b.tokens--
+		if b.tokens < tightest.tokens {
+			tightest = b
+		}
+	}
+	return Result{
+		Allowed:   true,
+		Limit:     tightest.limit,
+		Remaining: int(tightest.tokens),
+		Reset:     l.reset(tightest),
+	}
+}
+
+// Period is the time a bucket takes to refill.
+func (l *Limiter) Period() time.Duration {
+	return l.cfg.Period
+}
+
+// bucket returns the bucket of key refilled up to now. A new bucket, or
+// one whose limit changed with the role of its user, starts full.
+func (l *Limiter) bucket(key string, limit int, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{limit: limit, tokens: float64(limit), updated: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	if now.After(b.updated) {
+		b.tokens += now.Sub(b.updated).Seconds() * l.rate(b)
+		if b.tokens > float64(b.limit) {
+			b.tokens = float64(b.limit)
+		}
+		b.updated = now
+	}
+	return b
+}
+
+// sweep forgets the buckets that have been refilling for a whole period:
+// they are full, the same as new ones.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.cfg.Period {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.cfg.Period {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+// rate is the requests per second b refills with.
+func (l *Limiter) rate(b *bucket) float64 {
+	return float64(b.limit) / l.cfg.Period.Seconds()
+}
+
+func (l *Limiter) reset(b *bucket) time.Duration {
+	return time.Duration((float64(b.limit) - b.tokens) / l.rate(b) * float64(time.Second))
+}
+
+func (l *Limiter) retryAfter(b *bucket) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.rate(b) * float64(time.Second))
+}
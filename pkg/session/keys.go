@@ -0,0 +1,175 @@
+package session
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"filmlibrary/pkg/config"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// minSecretLen is the shortest HS256 secret accepted, as long as the hash.
+const minSecretLen = 32
+
+// Key is a JWT key identified by the kid header of the tokens it signs.
+// A key without a signing half only verifies.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// CanSign reports whether the key holds the secret or private half.
+func (k *Key) CanSign() bool {
+	return k.sign != nil
+}
+
+// NewHMACKey makes an HS256 key of secret.
+func NewHMACKey(kid string, secret []byte) (*Key, error) {
+	if len(secret) < minSecretLen {
+		return nil, fmt.Errorf("key %s: HS256 secret must be at least %d bytes", kid, minSecretLen)
+	}
+
+	return &Key{ID: kid, Method: jwt.SigningMethodHS256, sign: secret, verify: secret}, nil
+}
+
+// ParseKey reads a key for alg: the raw secret for HS256, a PEM encoded
+// private or public key for RS256 and EdDSA.
+func ParseKey(kid, alg string, data []byte) (*Key, error) {
+	switch alg {
+	case jwt.SigningMethodHS256.Alg():
+		return NewHMACKey(kid, []byte(strings.TrimSpace(string(data))))
+	case jwt.SigningMethodRS256.Alg():
+		key := &Key{ID: kid, Method: jwt.SigningMethodRS256}
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.sign, key.verify = private, &private.PublicKey
+			return key, nil
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", kid, err)
+		}
+		key.verify = public
+		return key, nil
+	case jwt.SigningMethodEdDSA.Alg():
+		key := &Key{ID: kid, Method: jwt.SigningMethodEdDSA}
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			key.sign, key.verify = private, private.(ed25519.PrivateKey).Public()
+			return key, nil
+		}
+		public, err := jwt.ParseEdPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", kid, err)
+		}
+		key.verify = public
+		return key, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported algorithm %q", kid, alg)
+	}
+}
+
+// Keys signs tokens with the primary key and accepts tokens signed by any
+// of its keys, so a key can be rotated out of signing while the tokens it
+// signed are still valid.
+type Keys struct {
+	primary    *Key
+	byID       map[string]*Key
+	ttl        time.Duration
+	refreshTTL time.Duration
+}
+
+// NewKeys builds a key set of keys, signing with the primary one. Access
+// tokens live for ttl, refresh tokens for refreshTTL.
+func NewKeys(primary string, ttl, refreshTTL time.Duration, keys ...*Key) (*Keys, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no JWT keys configured")
+	}
+	if primary == "" {
+		primary = keys[0].ID
+	}
+
+	set := &Keys{byID: make(map[string]*Key, len(keys)), ttl: ttl, refreshTTL: refreshTTL}
+	for _, key := range keys {
+		if _, ok := set.byID[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate JWT key %s", key.ID)
+		}
+		set.byID[key.ID] = key
+	}
+
+	set.primary = set.byID[primary]
+	if set.primary == nil {
+		return nil, fmt.Errorf("primary JWT key %s is not configured", primary)
+	}
+	if !set.primary.CanSign() {
+		return nil, fmt.Errorf("primary JWT key %s cannot sign: it is a public key", primary)
+	}
+
+	return set, nil
+}
+
+// LoadKeys builds the key set the config describes, reading key files.
+func LoadKeys(cfg config.JWT) (*Keys, error) {
+	var keys []*Key
+	for _, entry := range cfg.Keys {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("JWT key %q is not kid:alg:file", entry)
+		}
+
+		data, err := os.ReadFile(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", parts[0], err)
+		}
+
+		key, err := ParseKey(parts[0], parts[1], data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if cfg.Secret != "" {
+		key, err := NewHMACKey(cfg.SecretKID, []byte(cfg.Secret))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return NewKeys(cfg.PrimaryKID, cfg.TTL, cfg.RefreshTTL, keys...)
+}
+
+// verifyKey picks the key a token names in its kid header. The algorithm
+// must be the key's own, so a public key is never used as an HMAC secret.
+func (k *Keys) verifyKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := k.byID[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("bad sign method")
+	}
+
+	return key.verify, nil
+}
+
+// methods lists the algorithms of the keys, the only ones tokens may use.
+func (k *Keys) methods() []string {
+	var methods []string
+	seen := make(map[string]bool)
+	for _, key := range k.byID {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+
+	return methods
+}
@@ -5,23 +5,33 @@ import (
 	"filmlibrary/pkg/errs"
 	"filmlibrary/pkg/users"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	jwt "github.com/golang-jwt/jwt/v5"
 )
 
-var secret = []byte("secretKey")
+const (
+	// RefreshHeader carries the refresh token issued with an access token.
+	RefreshHeader = "X-Refresh-Token"
+	// maxUserAgentLen matches sessions.user_agent.
+	maxUserAgentLen = 500
+)
 
-func generateToken(user *users.User) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+func (k *Keys) generateToken(user *users.User, token users.RefreshToken, now time.Time) (string, error) {
+	jwtToken := jwt.NewWithClaims(k.primary.Method, jwt.MapClaims{
 		"user": user,
-		"iat":  time.Now().Unix(),
-		"exp":  time.Now().Add(time.Hour * 24 * 7).Unix(),
+		"jti":  token.AccessID,
+		"fam":  token.Family,
+		"iat":  now.Unix(),
+		"exp":  token.AccessExpiresAt.Unix(),
 	})
+	jwtToken.Header["kid"] = k.primary.ID
 
-	strToken, err := token.SignedString(secret)
+	strToken, err := jwtToken.SignedString(k.primary.sign)
 	if err != nil {
 		return "", err
 	}
@@ -29,22 +39,14 @@ func generateToken(user *users.User) (string, error) {
 	return strToken, nil
 }
 
-func GetUser(authStr string, repo *users.UserMemoryRepository) (*users.User, error) {
+func (k *Keys) GetUser(authStr string, repo users.UserRepo) (*users.User, error) {
 	auth := strings.Fields(authStr)
 
 	if len(auth) < 2 || auth[0] != "Bearer" {
 		return &users.User{}, nil
 	}
 
-	hashSecretGetter := func(token *jwt.Token) (interface{}, error) {
-		method, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok || method.Alg() != "HS256" {
-			return nil, fmt.Errorf("bad sign method")
-		}
-		return secret, nil
-	}
-
-	token, err := jwt.Parse(auth[1], hashSecretGetter)
+	token, err := jwt.Parse(auth[1], k.verifyKey, jwt.WithValidMethods(k.methods()))
 	if err != nil {
 		return &users.User{}, errors.New(errs.FailPassing)
 	}
@@ -54,34 +56,169 @@ func GetUser(authStr string, repo *users.UserMemoryRepository) (*users.User, err
 		return &users.User{}, errors.New(errs.InvalidToken)
 	}
 
+	jti, _ := claims["jti"].(string)
+	family, _ := claims["fam"].(string)
+	if jti == "" || family == "" {
+		return &users.User{}, errors.New(errs.InvalidToken)
+	}
+
 	u, ok := claims["user"].(map[string]interface{})
 	if !ok {
 		return &users.User{}, errors.New(errs.UserClaimsError)
 	}
 
-	user := users.User{}
+	user := users.User{TokenID: jti, SessionID: family}
 	if user.Login, ok = u["username"].(string); !ok {
 		return &users.User{}, errors.New(errs.UserClaimsError)
 	}
+	if id, ok := u["id"].(float64); ok {
+		user.ID = uint32(id)
+	}
 
-	if exist, err := repo.UserExists(user.Login); !exist || err != nil {
-		return &users.User{}, errors.New(errs.UserNotExist)
+	revoked, err := repo.TokenRevoked(jti)
+	if err != nil {
+		return &users.User{}, errors.New(errs.DatabaseError)
+	}
+	if revoked {
+		return &users.User{}, errors.New(errs.TokenRevoked)
 	}
 
-	if user.Role, err = repo.GetUserRole(user.Login); err != nil {
+	active, err := repo.TouchSession(family, time.Now())
+	if err != nil {
 		return &users.User{}, errors.New(errs.DatabaseError)
 	}
+	if !active {
+		return &users.User{}, errors.New(errs.TokenRevoked)
+	}
+
+	// a deleted user's name may be taken again: the ID must match as well
+	stored, err := repo.GetUserByUsername(user.Login)
+	if err != nil || stored.ID != user.ID {
+		return &users.User{}, errors.New(errs.UserNotExist)
+	}
+	if stored.Disabled {
+		return &users.User{}, errors.New(errs.UserDisabled)
+	}
+	user.Role = stored.Role
 
 	return &user, nil
 }
 
-func CreateToken(w http.ResponseWriter, user *users.User) error {
-	token, err := generateToken(user)
+// CreateToken starts a session for user from the client of r: a
+// short-lived access token in the Authorization header and a refresh token
+// in RefreshHeader.
+func (k *Keys) CreateToken(w http.ResponseWriter, r *http.Request, user *users.User, repo users.SessionRepo) error {
+	now := time.Now()
+
+	refresh, token, err := k.newRefreshToken(now)
+	if err != nil {
+		return err
+	}
+
+	token.Family, err = randomToken()
 	if err != nil {
 		return err
 	}
+	token.UserID = user.ID
+
+	session := users.Session{
+		ID:        token.Family,
+		UserID:    user.ID,
+		UserAgent: truncate(r.UserAgent(), maxUserAgentLen),
+		IP:        ClientIP(r),
+		CreatedAt: now,
+	}
+	if err := repo.CreateSession(session, token); err != nil {
+		return err
+	}
 
-	w.Header().Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return k.writeTokens(w, user, token, refresh, now)
+}
+
+// Refresh spends a refresh token for a new access and refresh token of the
+// same family. Spending one twice revokes the family: the token has leaked.
+func (k *Keys) Refresh(w http.ResponseWriter, refreshToken string, repo users.UserRepo) (*users.User, error) {
+	if refreshToken == "" {
+		return nil, errors.New(errs.InvalidRefreshToken)
+	}
+
+	now := time.Now()
+	refresh, next, err := k.newRefreshToken(now)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := repo.RotateRefreshToken(hashToken(refreshToken), next, now)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := repo.GetUserByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, errors.New(errs.UserDisabled)
+	}
+
+	if err := k.writeTokens(w, &user, token, refresh, now); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Logout ends the session the user authenticated with, the access token
+// in use included.
+func (k *Keys) Logout(user *users.User, repo users.TokenRepo) error {
+	return repo.RevokeFamily(user.SessionID, time.Now())
+}
+
+// newRefreshToken makes a refresh token and the row storing it, with the ID
+// and expiry of the access token to issue along.
+func (k *Keys) newRefreshToken(now time.Time) (string, users.RefreshToken, error) {
+	refresh, err := randomToken()
+	if err != nil {
+		return "", users.RefreshToken{}, err
+	}
+
+	jti, err := randomToken()
+	if err != nil {
+		return "", users.RefreshToken{}, err
+	}
+
+	return refresh, users.RefreshToken{
+		Hash:            hashToken(refresh),
+		AccessID:        jti,
+		AccessExpiresAt: now.Add(k.ttl),
+		ExpiresAt:       now.Add(k.refreshTTL),
+	}, nil
+}
+
+func (k *Keys) writeTokens(w http.ResponseWriter, user *users.User, token users.RefreshToken, refresh string, now time.Time) error {
+	access, err := k.generateToken(user, token, now)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Authorization", fmt.Sprintf("Bearer %s", access))
+	w.Header().Set(RefreshHeader, refresh)
 
 	return nil
 }
+
+// ClientIP returns the address of the client that sent r, without the port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,73 @@
+// Package translit builds search keys that are equal for a name written in
+// Cyrillic and its Latin transliteration, e.g. "Том Хэнкс" and "Tom Hanks".
+package translit
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MinKeyLen is the shortest key worth searching by: shorter keys match
+// too many unrelated names.
+const MinKeyLen = 3
+
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "h", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "sh", 'ъ': "",
+	'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// latin folds spellings that sound the same. sh and ch become digits so
+// the h rule below leaves them alone.
+var latin = strings.NewReplacer(
+	"dzh", "j", "zh", "j",
+	"sch", "2", "sh", "2", "ch", "1",
+	"ph", "f", "th", "t", "kh", "h", "ck", "k",
+	"qu", "kv", "q", "k", "w", "v", "x", "ks",
+	"ce", "se", "ci", "si", "cy", "sy", "c", "k", "z", "s",
+)
+
+// Normalize returns the search key of a name: it is transliterated to
+// Latin, spellings that sound alike are folded and only the consonant
+// skeleton is kept, without spaces.
+func Normalize(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		var latinWord strings.Builder
+		for _, r := range word {
+			if str, ok := cyrillic[r]; ok {
+				latinWord.WriteString(str)
+			} else {
+				latinWord.WriteRune(r)
+			}
+		}
+
+		var prev rune
+		for i, r := range latin.Replace(latinWord.String()) {
+			switch {
+			case strings.ContainsRune("aeiouy", r):
+				continue
+			case r == 'h' && i > 0:
+				continue
+			case r == prev:
+				continue
+			}
+
+			switch r {
+			case '1':
+				b.WriteString("ch")
+			case '2':
+				b.WriteString("sh")
+			default:
+				b.WriteRune(r)
+			}
+			prev = r
+		}
+	}
+
+	return b.String()
+}
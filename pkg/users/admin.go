@@ -0,0 +1,223 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/like"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Account is a user as admins see it.
+type Account struct {
+	ID       uint32 `json:"id"`
+	Login    string `json:"username"`
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled"`
+}
+
+// UserFilter selects users for ListUsers. Search matches a part of the
+// username; users come ordered by ID, after AfterID, at most Limit of them.
+type UserFilter struct {
+	Search  string
+	Role    string
+	AfterID uint32
+	Limit   int
+}
+
+// AdminRepo manages accounts on behalf of admins.
+type AdminRepo interface {
+	// ListUsers returns a page of the users matching filter and how many
+	// match in total.
+	ListUsers(filter UserFilter) ([]Account, int, error)
+	SetUserRole(id uint32, role string) error
+	// SetUserDisabled disables or enables a user. Disabling ends the
+	// sessions of the user.
+	SetUserDisabled(id uint32, disabled bool, now time.Time) error
+	DeleteUser(id uint32) error
+}
+
+func (u User) Account() Account {
+	return Account{ID: u.ID, Login: u.Login, Role: u.Role, Disabled: u.Disabled}
+}
+
+func (repo *UserMemoryRepository) ListUsers(filter UserFilter) ([]Account, int, error) {
+	pattern := "%" + like.Escape(filter.Search) + "%"
+
+	var total int
+	err := repo.DB.QueryRow(`
+        SELECT count(*) FROM users
+        WHERE username ILIKE $1 ESCAPE '\' AND ($2 = '' OR role = $2)`, pattern, filter.Role).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := repo.DB.Query(`
+        SELECT id, username, role, disabled_at IS NOT NULL FROM users
+        WHERE username ILIKE $1 ESCAPE '\' AND ($2 = '' OR role = $2) AND id > $3
+        ORDER BY id
+        LIMIT $4`, pattern, filter.Role, filter.AfterID, filter.Limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	accounts := make([]Account, 0)
+	for rows.Next() {
+		var account Account
+		if err := rows.Scan(&account.ID, &account.Login, &account.Role, &account.Disabled); err != nil {
+			return nil, 0, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, total, rows.Err()
+}
+
+func (repo *UserMemoryRepository) SetUserRole(id uint32, role string) error {
+	res, err := repo.DB.Exec("UPDATE users SET role = $1 WHERE id = $2", role, id)
+	if err != nil {
+		return err
+	}
+
+	return userAffected(res)
+}
+
+func (repo *UserMemoryRepository) SetUserDisabled(id uint32, disabled bool, now time.Time) error {
+	return repo.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+            UPDATE users SET disabled_at = CASE WHEN $1 THEN coalesce(disabled_at, $2) END
+            WHERE id = $3`, disabled, now, id)
+		if err != nil {
+			return err
+		}
+		if err := userAffected(res); err != nil {
+			return err
+		}
+
+		if !disabled {
+			return nil
+		}
+		_, err = revokeSessions(tx, id, "", "", now)
+		return err
+	})
+}
+
+func (repo *UserMemoryRepository) DeleteUser(id uint32) error {
+	// sessions and refresh tokens go with the user
+	res, err := repo.DB.Exec("DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return userAffected(res)
+}
+
+func userAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New(errs.UserNotExist)
+	}
+
+	return nil
+}
+
+func (repo *UserMapRepository) ListUsers(filter UserFilter) ([]Account, int, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	search := strings.ToLower(filter.Search)
+	var matched []Account
+	for _, user := range repo.users {
+		if !strings.Contains(strings.ToLower(user.Login), search) {
+			continue
+		}
+		if filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+		matched = append(matched, user.Account())
+	}
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	accounts := make([]Account, 0)
+	for _, account := range matched {
+		if account.ID <= filter.AfterID {
+			continue
+		}
+		if len(accounts) == filter.Limit {
+			break
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, len(matched), nil
+}
+
+func (repo *UserMapRepository) SetUserRole(id uint32, role string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	user, ok := repo.userByID(id)
+	if !ok {
+		return errors.New(errs.UserNotExist)
+	}
+
+	user.Role = role
+	return nil
+}
+
+func (repo *UserMapRepository) SetUserDisabled(id uint32, disabled bool, now time.Time) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	user, ok := repo.userByID(id)
+	if !ok {
+		return errors.New(errs.UserNotExist)
+	}
+
+	user.Disabled = disabled
+	if disabled {
+		repo.revokeSessions(id, "", "", now)
+	}
+	return nil
+}
+
+func (repo *UserMapRepository) DeleteUser(id uint32) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	user, ok := repo.userByID(id)
+	if !ok {
+		return errors.New(errs.UserNotExist)
+	}
+	delete(repo.users, strings.ToLower(user.Login))
+
+	for id, session := range repo.sessions {
+		if session.UserID == user.ID {
+			delete(repo.sessions, id)
+		}
+	}
+	for hash, token := range repo.refreshTokens {
+		if token.UserID == user.ID {
+			delete(repo.refreshTokens, hash)
+		}
+	}
+
+	return nil
+}
+
+func (repo *UserMapRepository) userByID(id uint32) (*User, bool) {
+	for _, user := range repo.users {
+		if user.ID == id {
+			return user, true
+		}
+	}
+
+	return nil, false
+}
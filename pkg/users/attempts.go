@@ -0,0 +1,193 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+// LoginAttempt tracks the failed logins of a key: a username or an IP.
+// Logins for the key wait until BlockedUntil; Locked tells a lockout from
+// a backoff.
+type LoginAttempt struct {
+	Key          string
+	Failures     int
+	LastFailure  time.Time
+	BlockedUntil time.Time
+	Locked       bool
+}
+
+// AttemptRepo keeps failed login attempts.
+type AttemptRepo interface {
+	// LoginAttempt returns the attempts of key, a zero LoginAttempt when
+	// there are none.
+	LoginAttempt(key string) (LoginAttempt, error)
+	// UpdateLogins passes the attempts of keys to fn, in the same order,
+	// and stores what fn leaves in them. Updates of the same key wait for
+	// each other. Attempts left without failures or a block are deleted.
+	UpdateLogins(keys []string, fn func(attempts []*LoginAttempt)) error
+	ResetLogin(key string) error
+	// PruneLogins deletes the keys whose last failure is older than before
+	// and which are not blocked at now.
+	PruneLogins(before, now time.Time) error
+}
+
+// attemptLockClass sets the advisory locks of login attempt keys apart from
+// other advisory locks.
+const attemptLockClass = 24
+
+func (repo *UserMemoryRepository) LoginAttempt(key string) (LoginAttempt, error) {
+	return loginAttempt(repo.DB, key)
+}
+
+func (repo *UserMemoryRepository) UpdateLogins(keys []string, fn func(attempts []*LoginAttempt)) error {
+	// lock in a fixed order so that two updates never wait for each other
+	locks := append([]string(nil), keys...)
+	sort.Strings(locks)
+
+	return repo.inTx(func(tx *sql.Tx) error {
+		for _, key := range locks {
+			if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1, hashtext($2))", attemptLockClass, key); err != nil {
+				return err
+			}
+		}
+
+		attempts := make([]*LoginAttempt, len(keys))
+		for i, key := range keys {
+			attempt, err := loginAttempt(tx, key)
+			if err != nil {
+				return err
+			}
+			attempts[i] = &attempt
+		}
+
+		fn(attempts)
+
+		for _, attempt := range attempts {
+			if err := saveLoginAttempt(tx, *attempt); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (repo *UserMemoryRepository) ResetLogin(key string) error {
+	_, err := repo.DB.Exec("DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
+
+func (repo *UserMemoryRepository) PruneLogins(before, now time.Time) error {
+	_, err := repo.DB.Exec(`
+        DELETE FROM login_attempts
+        WHERE last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until <= $2)`, before, now)
+	return err
+}
+
+// querier is what loginAttempt needs of a database or a transaction.
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func loginAttempt(q querier, key string) (LoginAttempt, error) {
+	attempt := LoginAttempt{Key: key}
+	var blockedUntil sql.NullTime
+	err := q.QueryRow(`
+        SELECT failures, last_failure_at, blocked_until, locked
+        FROM login_attempts WHERE key = $1`, key).
+		Scan(&attempt.Failures, &attempt.LastFailure, &blockedUntil, &attempt.Locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return attempt, nil
+	}
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+
+	attempt.BlockedUntil = blockedUntil.Time
+	return attempt, nil
+}
+
+func saveLoginAttempt(tx *sql.Tx, attempt LoginAttempt) error {
+	if attempt.empty() {
+		_, err := tx.Exec("DELETE FROM login_attempts WHERE key = $1", attempt.Key)
+		return err
+	}
+
+	var blockedUntil sql.NullTime
+	if !attempt.BlockedUntil.IsZero() {
+		blockedUntil = sql.NullTime{Time: attempt.BlockedUntil, Valid: true}
+	}
+
+	_, err := tx.Exec(`
+        INSERT INTO login_attempts (key, failures, last_failure_at, blocked_until, locked)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (key) DO UPDATE SET
+            failures = $2, last_failure_at = $3, blocked_until = $4, locked = $5`,
+		attempt.Key, attempt.Failures, attempt.LastFailure, blockedUntil, attempt.Locked)
+	return err
+}
+
+// empty reports whether the attempt holds nothing worth keeping.
+func (attempt LoginAttempt) empty() bool {
+	return attempt.Failures == 0 && attempt.BlockedUntil.IsZero() && !attempt.Locked
+}
+
+func (repo *UserMapRepository) LoginAttempt(key string) (LoginAttempt, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	attempt, ok := repo.attempts[key]
+	if !ok {
+		return LoginAttempt{Key: key}, nil
+	}
+
+	return *attempt, nil
+}
+
+func (repo *UserMapRepository) UpdateLogins(keys []string, fn func(attempts []*LoginAttempt)) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	attempts := make([]*LoginAttempt, len(keys))
+	for i, key := range keys {
+		attempt := LoginAttempt{Key: key}
+		if stored, ok := repo.attempts[key]; ok {
+			attempt = *stored
+		}
+		attempts[i] = &attempt
+	}
+
+	fn(attempts)
+
+	for _, attempt := range attempts {
+		if attempt.empty() {
+			delete(repo.attempts, attempt.Key)
+			continue
+		}
+		repo.attempts[attempt.Key] = attempt
+	}
+
+	return nil
+}
+
+func (repo *UserMapRepository) ResetLogin(key string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	delete(repo.attempts, key)
+	return nil
+}
+
+func (repo *UserMapRepository) PruneLogins(before, now time.Time) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for key, attempt := range repo.attempts {
+		if attempt.LastFailure.Before(before) && !attempt.BlockedUntil.After(now) {
+			delete(repo.attempts, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"filmlibrary/pkg/errs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultRole    = "viewer"
+	maxUsernameLen = 50
+)
+
+// UserMapRepository keeps users in a map. It mirrors the behaviour of
+// UserMemoryRepository without a database.
+type UserMapRepository struct {
+	mu sync.RWMutex
+	// users is keyed by the lower-cased username, like users_username_lower_idx.
+	users  map[string]*User
+	lastID uint32
+
+	// refreshTokens is keyed by token hash.
+	refreshTokens map[string]*storedRefreshToken
+	revokedTokens map[string]time.Time
+	sessions      map[string]*storedSession
+	attempts      map[string]*LoginAttempt
+}
+
+type storedRefreshToken struct {
+	RefreshToken
+	used    bool
+	revoked bool
+}
+
+type storedSession struct {
+	Session
+	revoked bool
+}
+
+func NewMapRepo() *UserMapRepository {
+	return &UserMapRepository{
+		users:         make(map[string]*User),
+		refreshTokens: make(map[string]*storedRefreshToken),
+		revokedTokens: make(map[string]time.Time),
+		sessions:      make(map[string]*storedSession),
+		attempts:      make(map[string]*LoginAttempt),
+	}
+}
+
+func (repo *UserMapRepository) GetUserRole(username string) (string, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	user, ok := repo.users[strings.ToLower(username)]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+
+	return user.Role, nil
+}
+
+func (repo *UserMapRepository) UserExists(username string) (bool, error) {
+	if username == "" {
+		return false, errors.New(errs.EmptyUsernameError)
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	_, ok := repo.users[strings.ToLower(username)]
+	return ok, nil
+}
+
+func (repo *UserMapRepository) GetUserByUsername(username string) (User, error) {
+	if username == "" {
+		return User{}, errors.New(errs.EmptyUsernameError)
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	user, ok := repo.users[strings.ToLower(username)]
+	if !ok {
+		return User{}, errors.New(errs.UserNotExist)
+	}
+
+	return *user, nil
+}
+
+func (repo *UserMapRepository) GetUserByID(id uint32) (User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	user, ok := repo.userByID(id)
+	if !ok {
+		return User{}, errors.New(errs.UserNotExist)
+	}
+
+	return *user, nil
+}
+
+func (repo *UserMapRepository) Authorize(login, password string) (*User, error) {
+	user, err := repo.GetUserByUsername(login)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.password), []byte(password)); err != nil {
+		return nil, errors.New(errs.BadPass)
+	}
+
+	if user.Disabled {
+		return nil, errors.New(errs.UserDisabled)
+	}
+
+	return &user, nil
+}
+
+func (repo *UserMapRepository) ChangePassword(id uint32, pass, keepSession string, now time.Time) error {
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.New(errs.HashPasswordError)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	user, ok := repo.userByID(id)
+	if !ok {
+		return errors.New(errs.UserNotExist)
+	}
+
+	user.password = string(hashedPass)
+	repo.revokeSessions(id, "", keepSession, now)
+	return nil
+}
+
+func (repo *UserMapRepository) Signup(username, pass string) (*User, error) {
+	return repo.AddUser(username, pass, defaultRole)
+}
+
+// AddUser registers a user with the given role, e.g. to seed an admin account.
+func (repo *UserMapRepository) AddUser(username, pass, role string) (*User, error) {
+	if username == "" {
+		return nil, errors.New(errs.EmptyUsernameError)
+	}
+
+	if utf8.RuneCountInString(username) > maxUsernameLen {
+		return nil, errors.New(errs.DatabaseError)
+	}
+
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.New(errs.HashPasswordError)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.users[strings.ToLower(username)]; ok {
+		return nil, errors.New(errs.UserExistError)
+	}
+
+	repo.lastID++
+	user := &User{ID: repo.lastID, Login: username, Role: role, password: string(hashedPass)}
+	repo.users[strings.ToLower(username)] = user
+
+	copied := *user
+	return &copied, nil
+}
+
+func (repo *UserMapRepository) RotateRefreshToken(hash string, next RefreshToken, now time.Time) (RefreshToken, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.refreshTokens[hash]
+	if !ok {
+		return RefreshToken{}, errors.New(errs.InvalidRefreshToken)
+	}
+
+	if stored.used && !stored.revoked {
+		repo.revokeFamily(stored.Family, now)
+		return RefreshToken{}, errors.New(errs.RefreshTokenReused)
+	}
+	if stored.used || stored.revoked || !stored.ExpiresAt.After(now) {
+		return RefreshToken{}, errors.New(errs.InvalidRefreshToken)
+	}
+
+	stored.used = true
+	next.Family, next.UserID = stored.Family, stored.UserID
+	repo.refreshTokens[next.Hash] = &storedRefreshToken{RefreshToken: next}
+	if session, ok := repo.sessions[next.Family]; ok {
+		session.LastSeenAt, session.ExpiresAt = now, next.ExpiresAt
+	}
+
+	return next, nil
+}
+
+func (repo *UserMapRepository) RevokeFamily(family string, now time.Time) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.revokeFamily(family, now)
+	return nil
+}
+
+func (repo *UserMapRepository) revokeFamily(family string, now time.Time) {
+	for jti, expiresAt := range repo.revokedTokens {
+		if !expiresAt.After(now) {
+			delete(repo.revokedTokens, jti)
+		}
+	}
+
+	for _, token := range repo.refreshTokens {
+		if token.Family != family || token.revoked {
+			continue
+		}
+		if token.AccessExpiresAt.After(now) {
+			repo.revokedTokens[token.AccessID] = token.AccessExpiresAt
+		}
+		token.revoked = true
+	}
+
+	if session, ok := repo.sessions[family]; ok {
+		session.revoked = true
+	}
+}
+
+func (repo *UserMapRepository) TokenRevoked(jti string) (bool, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	_, ok := repo.revokedTokens[jti]
+	return ok, nil
+}
+
+func (repo *UserMapRepository) CreateSession(session Session, token RefreshToken) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.sessions[session.ID]; ok {
+		return errors.New(errs.DatabaseError)
+	}
+	if _, ok := repo.refreshTokens[token.Hash]; ok {
+		return errors.New(errs.DatabaseError)
+	}
+
+	session.LastSeenAt, session.ExpiresAt, session.Current = session.CreatedAt, token.ExpiresAt, false
+	repo.sessions[session.ID] = &storedSession{Session: session}
+	repo.refreshTokens[token.Hash] = &storedRefreshToken{RefreshToken: token}
+	return nil
+}
+
+func (repo *UserMapRepository) TouchSession(id string, now time.Time) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	session, ok := repo.sessions[id]
+	if !ok || !session.active(now) {
+		return false, nil
+	}
+
+	if session.LastSeenAt.Before(now.Add(-lastSeenPrecision)) {
+		session.LastSeenAt = now
+	}
+	return true, nil
+}
+
+func (repo *UserMapRepository) ListSessions(userID uint32, now time.Time) ([]Session, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	sessions := make([]Session, 0)
+	for _, session := range repo.sessions {
+		if session.UserID == userID && session.active(now) {
+			sessions = append(sessions, session.Session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeenAt.Equal(sessions[j].LastSeenAt) {
+			return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+
+	return sessions, nil
+}
+
+func (repo *UserMapRepository) RevokeSessions(userID uint32, id string, now time.Time) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	return repo.revokeSessions(userID, id, "", now), nil
+}
+
+func (repo *UserMapRepository) revokeSessions(userID uint32, id, except string, now time.Time) int64 {
+	var revoked int64
+	for _, session := range repo.sessions {
+		if session.UserID != userID || !session.active(now) || (id != "" && session.ID != id) || session.ID == except {
+			continue
+		}
+		repo.revokeFamily(session.ID, now)
+		revoked++
+	}
+
+	return revoked
+}
+
+func (session *storedSession) active(now time.Time) bool {
+	return !session.revoked && session.ExpiresAt.After(now)
+}
@@ -4,10 +4,14 @@ import (
 	"database/sql"
 	"errors"
 	"filmlibrary/pkg/errs"
+	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const uniqueViolation = "23505"
+
 type UserMemoryRepository struct {
 	DB *sql.DB
 }
@@ -20,7 +24,7 @@ func NewMemoryRepo(db *sql.DB) *UserMemoryRepository {
 
 func (repo *UserMemoryRepository) GetUserRole(username string) (string, error) {
 	var role string
-	err := repo.DB.QueryRow("SELECT role FROM users WHERE username = $1", username).Scan(&role)
+	err := repo.DB.QueryRow("SELECT role FROM users WHERE lower(username) = lower($1)", username).Scan(&role)
 	if err != nil {
 		return "", err
 	}
@@ -33,7 +37,7 @@ func (repo *UserMemoryRepository) UserExists(username string) (bool, error) {
 		return false, errors.New(errs.EmptyUsernameError)
 	}
 
-	err := repo.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)", username).Scan(&exists)
+	err := repo.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE lower(username) = lower($1))", username).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
@@ -41,7 +45,7 @@ func (repo *UserMemoryRepository) UserExists(username string) (bool, error) {
 	return exists, nil
 }
 
-func (repo *UserMemoryRepository) getUserByUsername(username string) (User, error) {
+func (repo *UserMemoryRepository) GetUserByUsername(username string) (User, error) {
 	var user User
 
 	exist, err := repo.UserExists(username)
@@ -53,14 +57,28 @@ func (repo *UserMemoryRepository) getUserByUsername(username string) (User, erro
 		return User{}, errors.New(errs.UserNotExist)
 	}
 
-	query := "SELECT id, username, hashed_password FROM users WHERE username=$1"
+	query := "SELECT id, username, role, hashed_password, disabled_at IS NOT NULL FROM users WHERE lower(username) = lower($1)"
 	stmt, err := repo.DB.Prepare(query)
 	if err != nil {
 		return User{}, err
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(username).Scan(&user.ID, &user.Login, &user.password)
+	err = stmt.QueryRow(username).Scan(&user.ID, &user.Login, &user.Role, &user.password, &user.Disabled)
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func (repo *UserMemoryRepository) GetUserByID(id uint32) (User, error) {
+	var user User
+	err := repo.DB.QueryRow("SELECT id, username, role, hashed_password, disabled_at IS NOT NULL FROM users WHERE id = $1", id).
+		Scan(&user.ID, &user.Login, &user.Role, &user.password, &user.Disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, errors.New(errs.UserNotExist)
+	}
 	if err != nil {
 		return User{}, err
 	}
@@ -69,7 +87,7 @@ func (repo *UserMemoryRepository) getUserByUsername(username string) (User, erro
 }
 
 func (repo *UserMemoryRepository) Authorize(login, password string) (*User, error) {
-	user, err := repo.getUserByUsername(login)
+	user, err := repo.GetUserByUsername(login)
 	if err != nil {
 		return nil, err
 	}
@@ -78,9 +96,33 @@ func (repo *UserMemoryRepository) Authorize(login, password string) (*User, erro
 		return nil, errors.New(errs.BadPass)
 	}
 
+	if user.Disabled {
+		return nil, errors.New(errs.UserDisabled)
+	}
+
 	return &user, nil
 }
 
+func (repo *UserMemoryRepository) ChangePassword(id uint32, pass, keepSession string, now time.Time) error {
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.New(errs.HashPasswordError)
+	}
+
+	return repo.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE users SET hashed_password = $1 WHERE id = $2", string(hashedPass), id)
+		if err != nil {
+			return err
+		}
+		if err := userAffected(res); err != nil {
+			return err
+		}
+
+		_, err = revokeSessions(tx, id, "", keepSession, now)
+		return err
+	})
+}
+
 func (repo *UserMemoryRepository) Signup(username, pass string) (*User, error) {
 	exist, err := repo.UserExists(username)
 	if err != nil {
@@ -97,8 +139,13 @@ func (repo *UserMemoryRepository) Signup(username, pass string) (*User, error) {
 
 	user := &User{Login: username, password: string(hashedPass)}
 
-	err = repo.DB.QueryRow("INSERT INTO users (username, hashed_password) VALUES ($1, $2) RETURNING id", username, string(hashedPass)).Scan(&user.ID)
+	err = repo.DB.QueryRow("INSERT INTO users (username, hashed_password) VALUES ($1, $2) RETURNING id, role", username, string(hashedPass)).Scan(&user.ID, &user.Role)
 	if err != nil {
+		// a concurrent Signup may take the name between the check and the insert
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return nil, errors.New(errs.UserExistError)
+		}
 		return nil, errors.New(errs.DatabaseError)
 	}
 
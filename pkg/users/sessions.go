@@ -0,0 +1,143 @@
+package users
+
+import (
+	"database/sql"
+	"time"
+)
+
+// lastSeenPrecision limits how often TouchSession writes the last seen time,
+// so authenticated requests do not all turn into writes.
+const lastSeenPrecision = time.Minute
+
+// Session is one login of a user: the client it was made from and the
+// refresh token family it started. ID is the family.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     uint32    `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current marks the session of the request listing the sessions.
+	Current bool `json:"current"`
+}
+
+// SessionRepo keeps the sessions of users. A session is active until it is
+// revoked or the last refresh token of its family expires.
+type SessionRepo interface {
+	// CreateSession stores a session with the first refresh token of its family.
+	CreateSession(session Session, token RefreshToken) error
+	// TouchSession reports whether the session is active and records it as
+	// seen at now.
+	TouchSession(id string, now time.Time) (bool, error)
+	// ListSessions returns the active sessions of a user, the last seen first.
+	ListSessions(userID uint32, now time.Time) ([]Session, error)
+	// RevokeSessions ends the active sessions of a user, only the session id
+	// when it is not empty, and returns how many were ended.
+	RevokeSessions(userID uint32, id string, now time.Time) (int64, error)
+}
+
+func (repo *UserMemoryRepository) CreateSession(session Session, token RefreshToken) error {
+	return repo.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+            INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_seen_at, expires_at)
+            VALUES ($1, $2, $3, $4, $5, $5, $6)`,
+			session.ID, session.UserID, session.UserAgent, session.IP, session.CreatedAt, token.ExpiresAt)
+		if err != nil {
+			return err
+		}
+
+		return saveRefreshToken(tx, token)
+	})
+}
+
+func (repo *UserMemoryRepository) TouchSession(id string, now time.Time) (bool, error) {
+	var active bool
+	err := repo.DB.QueryRow(`
+        WITH touched AS (
+            UPDATE sessions SET last_seen_at = $2
+            WHERE id = $1 AND revoked_at IS NULL AND expires_at > $2 AND last_seen_at < $3
+            RETURNING id
+        )
+        SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > $2)`,
+		id, now, now.Add(-lastSeenPrecision)).Scan(&active)
+	if err != nil {
+		return false, err
+	}
+
+	return active, nil
+}
+
+func (repo *UserMemoryRepository) ListSessions(userID uint32, now time.Time) ([]Session, error) {
+	rows, err := repo.DB.Query(`
+        SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at
+        FROM sessions
+        WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+        ORDER BY last_seen_at DESC, id`, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (repo *UserMemoryRepository) RevokeSessions(userID uint32, id string, now time.Time) (int64, error) {
+	var revoked int64
+	err := repo.inTx(func(tx *sql.Tx) error {
+		var err error
+		revoked, err = revokeSessions(tx, userID, id, "", now)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return revoked, nil
+}
+
+// revokeSessions ends the active sessions of a user: only the session id
+// when it is not empty, all but except otherwise.
+func revokeSessions(tx *sql.Tx, userID uint32, id, except string, now time.Time) (int64, error) {
+	rows, err := tx.Query(`
+        SELECT id FROM sessions
+        WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2 AND ($3 = '' OR id = $3) AND id <> $4
+        FOR UPDATE`, userID, now, id, except)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := revokeFamily(tx, id, now); err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(ids)), nil
+}
@@ -0,0 +1,145 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"filmlibrary/pkg/errs"
+	"time"
+)
+
+// RefreshToken is a stored refresh token. Only the hash of the token is
+// kept. Tokens rotated from one login share a Family; AccessID and
+// AccessExpiresAt describe the access token issued together with it.
+type RefreshToken struct {
+	Hash            string
+	Family          string
+	UserID          uint32
+	AccessID        string
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time
+}
+
+// TokenRepo keeps refresh tokens and the IDs of revoked access tokens.
+// The first token of a family is stored by SessionRepo.CreateSession.
+type TokenRepo interface {
+	// RotateRefreshToken spends the token with hash and stores next in its
+	// family. Spending a token twice revokes the family and its session, and fails with
+	// errs.RefreshTokenReused.
+	RotateRefreshToken(hash string, next RefreshToken, now time.Time) (RefreshToken, error)
+	// RevokeFamily revokes the refresh tokens of a family, the access
+	// tokens issued with them and the session they belong to.
+	RevokeFamily(family string, now time.Time) error
+	TokenRevoked(jti string) (bool, error)
+}
+
+func (repo *UserMemoryRepository) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repo *UserMemoryRepository) RotateRefreshToken(hash string, next RefreshToken, now time.Time) (RefreshToken, error) {
+	reused := false
+	err := repo.inTx(func(tx *sql.Tx) error {
+		var used, revoked sql.NullTime
+		var expiresAt time.Time
+		err := tx.QueryRow(`
+            SELECT family_id, user_id, expires_at, used_at, revoked_at
+            FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`, hash).
+			Scan(&next.Family, &next.UserID, &expiresAt, &used, &revoked)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New(errs.InvalidRefreshToken)
+		}
+		if err != nil {
+			return err
+		}
+
+		if used.Valid && !revoked.Valid {
+			// the family stays revoked although the rotation fails
+			reused = true
+			return revokeFamily(tx, next.Family, now)
+		}
+		if used.Valid || revoked.Valid || !expiresAt.After(now) {
+			return errors.New(errs.InvalidRefreshToken)
+		}
+
+		_, err = tx.Exec("UPDATE refresh_tokens SET used_at = $1 WHERE token_hash = $2", now, hash)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE sessions SET last_seen_at = $1, expires_at = $2 WHERE id = $3", now, next.ExpiresAt, next.Family)
+		if err != nil {
+			return err
+		}
+
+		return saveRefreshToken(tx, next)
+	})
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if reused {
+		return RefreshToken{}, errors.New(errs.RefreshTokenReused)
+	}
+
+	return next, nil
+}
+
+func (repo *UserMemoryRepository) RevokeFamily(family string, now time.Time) error {
+	return repo.inTx(func(tx *sql.Tx) error {
+		return revokeFamily(tx, family, now)
+	})
+}
+
+// revokeFamily also forgets the revoked jtis whose access tokens have
+// expired: the token signature check refuses those on its own.
+func revokeFamily(tx *sql.Tx, family string, now time.Time) error {
+	_, err := tx.Exec("DELETE FROM revoked_tokens WHERE expires_at <= $1", now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO revoked_tokens (jti, expires_at)
+        SELECT access_jti, access_expires_at FROM refresh_tokens
+        WHERE family_id = $1 AND revoked_at IS NULL AND access_expires_at > $2
+        ON CONFLICT (jti) DO NOTHING`, family, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL", now, family)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL", now, family)
+	return err
+}
+
+func saveRefreshToken(tx *sql.Tx, token RefreshToken) error {
+	_, err := tx.Exec(`
+        INSERT INTO refresh_tokens (token_hash, family_id, user_id, access_jti, access_expires_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)`,
+		token.Hash, token.Family, token.UserID, token.AccessID, token.AccessExpiresAt, token.ExpiresAt)
+	return err
+}
+
+func (repo *UserMemoryRepository) TokenRevoked(jti string) (bool, error) {
+	var revoked bool
+	err := repo.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
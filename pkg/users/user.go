@@ -2,6 +2,7 @@ package users
 
 import (
 	"context"
+	"time"
 )
 
 type ContextKey string
@@ -13,6 +14,11 @@ type User struct {
 	Login    string `json:"username"`
 	Role     string
 	password string
+	Disabled bool `json:"-"`
+	// TokenID and SessionID are the jti and token family of the access
+	// token the user authenticated with.
+	TokenID   string `json:"-"`
+	SessionID string `json:"-"`
 }
 
 type UserRepo interface {
@@ -20,9 +26,23 @@ type UserRepo interface {
 	Signup(login, pass string) (*User, error)
 	UserExists(login string) (bool, error)
 	GetUserRole(username string) (string, error)
-	getUserByUsername(username string) (User, error)
+	GetUserByUsername(username string) (User, error)
+	GetUserByID(id uint32) (User, error)
+	// ChangePassword sets a new password and ends the sessions of the user
+	// but keepSession.
+	ChangePassword(id uint32, pass, keepSession string, now time.Time) error
+	TokenRepo
+	SessionRepo
+	AdminRepo
+	AttemptRepo
 }
 
 func ContextWithUser(ctx context.Context, user *User) context.Context {
 	return context.WithValue(ctx, ContextUserKey, user)
 }
+
+// UserFromContext returns the user ContextWithUser stored, if any.
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(ContextUserKey).(*User)
+	return user, ok
+}
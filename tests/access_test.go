@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"filmlibrary/pkg/access"
+	"filmlibrary/pkg/config"
+	"filmlibrary/pkg/explorer"
+	"filmlibrary/pkg/items"
+	"filmlibrary/pkg/users"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestPolicyDefaults(t *testing.T) {
+	policy, err := access.NewPolicy(config.Permissions{})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	cases := []struct {
+		role    access.Role
+		perm    access.Permission
+		allowed bool
+	}{
+		{access.Guest, access.FilmsRead, true},
+		{access.Guest, access.Account, false},
+		{access.Viewer, access.Account, true},
+		{access.Viewer, access.FilmsCreate, false},
+		{access.Editor, access.FilmsUpdate, true},
+		{access.Editor, access.FilmsDelete, false},
+		{access.Moderator, access.ActorsDelete, true},
+		{access.Moderator, access.TrashRestore, true},
+		{access.Moderator, access.TrashPurge, false},
+		{access.Admin, access.UsersManage, true},
+		{access.Role("user"), access.FilmsRead, true},
+		{access.Role("user"), access.Account, false},
+		{access.Admin, access.Permission("films.watch"), false},
+	}
+	for _, c := range cases {
+		if got := policy.Allows(c.role, c.perm); got != c.allowed {
+			t.Errorf("Allows(%s, %s) = %v, expected %v", c.role, c.perm, got, c.allowed)
+		}
+	}
+
+	if access.Valid(access.Guest) || access.Valid(access.Role("user")) || !access.Valid(access.Editor) {
+		t.Errorf("Valid: guest and unknown roles must not be stored, editor must")
+	}
+}
+
+func TestPolicyOverrides(t *testing.T) {
+	policy, err := access.NewPolicy(config.Permissions{Overrides: map[string]string{
+		"films.read": "viewer",
+		"trash.read": "editor",
+	}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	if policy.Allows(access.Guest, access.FilmsRead) || !policy.Allows(access.Viewer, access.FilmsRead) {
+		t.Errorf("films.read: expected viewer and up only")
+	}
+	if !policy.Allows(access.Editor, access.TrashRead) {
+		t.Errorf("trash.read: expected editor to be allowed")
+	}
+	if policy.Allows(access.Moderator, access.TrashPurge) {
+		t.Errorf("trash.purge: expected the default to stay")
+	}
+
+	for _, overrides := range []map[string]string{
+		{"films.watch": "viewer"},
+		{"films.read": "owner"},
+	} {
+		if _, err := access.NewPolicy(config.Permissions{Overrides: overrides}); err == nil {
+			t.Errorf("NewPolicy(%v): expected an error", overrides)
+		}
+	}
+}
+
+func TestAuthorizeRoutes(t *testing.T) {
+	useTestKeys(t)
+	t.Setenv("PERMISSIONS", "actors.read:viewer")
+
+	userRepo := users.NewMapRepo()
+	for _, role := range []string{"viewer", "editor", "moderator", "admin"} {
+		if _, err := userRepo.AddUser(role, "MySuperSecretPassword", role); err != nil {
+			t.Fatalf("AddUser: %v", err)
+		}
+	}
+
+	itemRepo := items.NewMapRepo()
+	for i := 0; i < 2; i++ {
+		if _, err := itemRepo.CreateFilm(items.Film{Name: "film"}); err != nil {
+			t.Fatalf("CreateFilm: %v", err)
+		}
+	}
+
+	handler, err := explorer.NewRepoExplorer(itemRepo, userRepo, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewRepoExplorer: %v", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	tokens := map[string]string{}
+	for _, role := range []string{"viewer", "editor", "moderator", "admin"} {
+		data, _ := json.Marshal(CR{"username": role, "password": "MySuperSecretPassword"})
+		resp, err := client.Post(ts.URL+"/api/login", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("login %s: %v", role, err)
+		}
+		resp.Body.Close()
+		tokens[role] = resp.Header.Get("Authorization")
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		login  string
+		body   interface{}
+		status int
+	}{
+		{"guest reads films", http.MethodGet, "/api/films", "", nil, http.StatusOK},
+		{"guest cannot read actors", http.MethodGet, "/api/actors", "", nil, http.StatusUnauthorized},
+		{"viewer reads actors", http.MethodGet, "/api/actors", "viewer", nil, http.StatusOK},
+		{"guest cannot list sessions", http.MethodGet, "/api/me/sessions", "", nil, http.StatusUnauthorized},
+		{"viewer lists sessions", http.MethodGet, "/api/me/sessions", "viewer", nil, http.StatusOK},
+		{"viewer cannot create film", http.MethodPost, "/api/films", "viewer", CR{"name": "new"}, http.StatusForbidden},
+		{"editor creates film", http.MethodPost, "/api/films", "editor", CR{"name": "new"}, http.StatusCreated},
+		{"editor cannot delete film", http.MethodDelete, "/api/films/1", "editor", nil, http.StatusForbidden},
+		{"editor cannot read trash", http.MethodGet, "/api/trash", "editor", nil, http.StatusForbidden},
+		{"moderator deletes film", http.MethodDelete, "/api/films/1", "moderator", nil, http.StatusOK},
+		{"moderator reads trash", http.MethodGet, "/api/trash", "moderator", nil, http.StatusOK},
+		{"moderator restores film", http.MethodPost, "/api/trash/films/1/restore", "moderator", nil, http.StatusOK},
+		{"moderator cannot purge trash", http.MethodDelete, "/api/trash", "moderator", nil, http.StatusForbidden},
+		{"moderator cannot revoke user sessions", http.MethodDelete, "/api/users/1/sessions", "moderator", nil, http.StatusForbidden},
+		{"admin purges trash", http.MethodDelete, "/api/trash", "admin", nil, http.StatusOK},
+		{"admin revokes user sessions", http.MethodDelete, "/api/users/1/sessions", "admin", nil, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		var body bytes.Buffer
+		if c.body != nil {
+			if err := json.NewEncoder(&body).Encode(c.body); err != nil {
+				t.Fatalf("%s: encode: %v", c.name, err)
+			}
+		}
+
+		req, err := http.NewRequest(c.method, ts.URL+c.path, &body)
+		if err != nil {
+			t.Fatalf("%s: NewRequest: %v", c.name, err)
+		}
+		req.Header.Set("Authorization", tokens[c.login])
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: expected %d, got %d", c.name, c.status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"filmlibrary/pkg/explorer"
+	"filmlibrary/pkg/items"
+	"filmlibrary/pkg/users"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestAccountsEndpoints(t *testing.T) {
+	useTestKeys(t)
+
+	userRepo := sessionUsers(t)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := userRepo.Signup(name, "MySuperSecretPassword"); err != nil {
+			t.Fatalf("Signup: %v", err)
+		}
+	}
+
+	handler, err := explorer.NewRepoExplorer(items.NewMapRepo(), userRepo, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewRepoExplorer: %v", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	type page struct {
+		Data       []users.Account `json:"data"`
+		NextCursor string          `json:"next_cursor"`
+		Total      int             `json:"total"`
+	}
+
+	do := func(method, path, auth string, body, data interface{}) int {
+		t.Helper()
+		return apiCall(t, ts, method, path, auth, body, data)
+	}
+	login := func(username string) (string, int) {
+		t.Helper()
+
+		data, _ := json.Marshal(CR{"username": username, "password": "MySuperSecretPassword"})
+		resp, err := client.Post(ts.URL+"/api/login", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("Authorization"), resp.StatusCode
+	}
+
+	admin, _ := login("admin")
+	bob, _ := login("bob")
+
+	var first page
+	if status := do(http.MethodGet, "/api/users?limit=2", admin, nil, &first); status != http.StatusOK {
+		t.Fatalf("GET /api/users: status %d", status)
+	}
+	if first.Total != 4 || len(first.Data) != 2 || first.NextCursor == "" {
+		t.Fatalf("GET /api/users: unexpected first page %+v", first)
+	}
+	var second page
+	do(http.MethodGet, "/api/users?limit=2&cursor="+first.NextCursor, admin, nil, &second)
+	if len(second.Data) != 2 || second.Data[0].Login != "bob" || second.NextCursor != "" {
+		t.Fatalf("GET /api/users: unexpected second page %+v", second)
+	}
+
+	var found page
+	do(http.MethodGet, "/api/users?search=CAR", admin, nil, &found)
+	if found.Total != 1 || found.Data[0].Login != "carol" {
+		t.Fatalf("GET /api/users?search=CAR: got %+v", found)
+	}
+	if status := do(http.MethodGet, "/api/users?role=owner", admin, nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("GET /api/users?role=owner: expected 400, got %d", status)
+	}
+	if status := do(http.MethodGet, "/api/users", bob, nil, nil); status != http.StatusForbidden {
+		t.Fatalf("GET /api/users as a viewer: expected 403, got %d", status)
+	}
+
+	bobUser, _ := userRepo.GetUserByUsername("bob")
+	path := fmt.Sprintf("/api/users/%d", bobUser.ID)
+
+	var account struct{ Data users.Account }
+	if status := do(http.MethodGet, path, admin, nil, &account); status != http.StatusOK || account.Data.Login != "bob" || account.Data.Role != "viewer" {
+		t.Fatalf("GET %s: status %d, %+v", path, status, account.Data)
+	}
+	if status := do(http.MethodGet, "/api/users/1000", admin, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("GET a missing user: expected 404, got %d", status)
+	}
+
+	if status := do(http.MethodPost, path+"/role", admin, CR{"role": "owner"}, nil); status != http.StatusUnprocessableEntity {
+		t.Fatalf("POST role owner: expected 422, got %d", status)
+	}
+	if status := do(http.MethodPost, path+"/role", admin, CR{"role": "editor"}, &account); status != http.StatusOK || account.Data.Role != "editor" {
+		t.Fatalf("POST role editor: status %d, %+v", status, account.Data)
+	}
+	if status := do(http.MethodPost, "/api/films", bob, CR{"name": "new"}, nil); status != http.StatusCreated {
+		t.Fatalf("editor creates film with the old token: expected 201, got %d", status)
+	}
+
+	adminUser, _ := userRepo.GetUserByUsername("admin")
+	if status := do(http.MethodPost, fmt.Sprintf("/api/users/%d/disable", adminUser.ID), admin, nil, nil); status != http.StatusConflict {
+		t.Fatalf("admin disables themselves: expected 409, got %d", status)
+	}
+
+	if status := do(http.MethodPost, path+"/disable", admin, nil, &account); status != http.StatusOK || !account.Data.Disabled {
+		t.Fatalf("POST disable: status %d, %+v", status, account.Data)
+	}
+	if status := do(http.MethodGet, "/api/films", bob, nil, nil); status != http.StatusForbidden {
+		t.Fatalf("token of a disabled user: expected 403, got %d", status)
+	}
+	if _, status := login("bob"); status != http.StatusUnauthorized {
+		t.Fatalf("login of a disabled user: expected 401, got %d", status)
+	}
+
+	if status := do(http.MethodPost, path+"/enable", admin, nil, &account); status != http.StatusOK || account.Data.Disabled {
+		t.Fatalf("POST enable: status %d, %+v", status, account.Data)
+	}
+	bob, status := login("bob")
+	if status != http.StatusOK {
+		t.Fatalf("login after enable: expected 200, got %d", status)
+	}
+
+	if status := do(http.MethodDelete, path, admin, nil, nil); status != http.StatusOK {
+		t.Fatalf("DELETE %s: expected 200, got %d", path, status)
+	}
+	if status := do(http.MethodGet, "/api/films", bob, nil, nil); status != http.StatusForbidden {
+		t.Fatalf("token of a deleted user: expected 403, got %d", status)
+	}
+	if status := do(http.MethodDelete, path, admin, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("DELETE a deleted user: expected 404, got %d", status)
+	}
+}
+
+func TestMeEndpoints(t *testing.T) {
+	useTestKeys(t)
+
+	userRepo := sessionUsers(t)
+	handler, err := explorer.NewRepoExplorer(items.NewMapRepo(), userRepo, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewRepoExplorer: %v", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	do := func(method, path, auth string, body, data interface{}) int {
+		t.Helper()
+		return apiCall(t, ts, method, path, auth, body, data)
+	}
+	login := func(password string) (string, int) {
+		t.Helper()
+
+		data, _ := json.Marshal(CR{"username": "dave", "password": password})
+		resp, err := client.Post(ts.URL+"/api/login", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("Authorization"), resp.StatusCode
+	}
+
+	if status := do(http.MethodPost, "/api/register", "", CR{"username": "dave", "password": "MySuperSecretPassword"}, nil); status != http.StatusCreated {
+		t.Fatalf("register: status %d", status)
+	}
+	laptop, _ := login("MySuperSecretPassword")
+	phone, _ := login("MySuperSecretPassword")
+
+	var me struct{ Data users.Account }
+	if status := do(http.MethodGet, "/api/me", laptop, nil, &me); status != http.StatusOK || me.Data.Login != "dave" || me.Data.Role != "viewer" {
+		t.Fatalf("GET /api/me: status %d, %+v", status, me.Data)
+	}
+	if status := do(http.MethodGet, "/api/me", "", nil, nil); status != http.StatusUnauthorized {
+		t.Fatalf("GET /api/me signed out: expected 401, got %d", status)
+	}
+
+	cases := []struct {
+		name   string
+		body   interface{}
+		status int
+	}{
+		{"wrong old password", CR{"old_password": "wrong", "new_password": "AnotherSecretPassword"}, http.StatusForbidden},
+		{"short new password", CR{"old_password": "MySuperSecretPassword", "new_password": "short"}, http.StatusUnprocessableEntity},
+		{"bad json", "password", http.StatusBadRequest},
+		{"changed", CR{"old_password": "MySuperSecretPassword", "new_password": "AnotherSecretPassword"}, http.StatusOK},
+	}
+	for _, c := range cases {
+		if status := do(http.MethodPost, "/api/me/password", laptop, c.body, nil); status != c.status {
+			t.Fatalf("%s: expected %d, got %d", c.name, c.status, status)
+		}
+	}
+
+	if status := do(http.MethodGet, "/api/me", laptop, nil, nil); status != http.StatusOK {
+		t.Fatalf("the session changing the password: expected 200, got %d", status)
+	}
+	if status := do(http.MethodGet, "/api/me", phone, nil, nil); status != http.StatusForbidden {
+		t.Fatalf("other session after the password change: expected 403, got %d", status)
+	}
+	if _, status := login("MySuperSecretPassword"); status != http.StatusUnauthorized {
+		t.Fatalf("login with the old password: expected 401, got %d", status)
+	}
+	if _, status := login("AnotherSecretPassword"); status != http.StatusOK {
+		t.Fatalf("login with the new password: expected 200, got %d", status)
+	}
+
+	if status := do(http.MethodDelete, "/api/me", laptop, nil, nil); status != http.StatusOK {
+		t.Fatalf("DELETE /api/me: expected 200, got %d", status)
+	}
+	if status := do(http.MethodGet, "/api/me", laptop, nil, nil); status != http.StatusForbidden {
+		t.Fatalf("token of a deleted account: expected 403, got %d", status)
+	}
+	if _, status := login("AnotherSecretPassword"); status != http.StatusUnauthorized {
+		t.Fatalf("login of a deleted account: expected 401, got %d", status)
+	}
+	if exists, _ := userRepo.UserExists("dave"); exists {
+		t.Fatalf("dave: expected the account to be erased")
+	}
+
+	data, _ := json.Marshal(CR{"username": "admin", "password": "MySuperSecretPassword"})
+	resp, err := client.Post(ts.URL+"/api/login", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	resp.Body.Close()
+	admin := resp.Header.Get("Authorization")
+	if status := do(http.MethodDelete, "/api/me", admin, nil, nil); status != http.StatusConflict {
+		t.Fatalf("DELETE /api/me as admin: expected 409, got %d", status)
+	}
+	if exists, _ := userRepo.UserExists("admin"); !exists {
+		t.Fatalf("admin: expected the account to stay")
+	}
+}
+
+// apiCall sends body as JSON with the auth header and decodes a 200
+// response into data. It returns the status.
+func apiCall(t *testing.T, ts *httptest.Server, method, path, auth string, body, data interface{}) int {
+	t.Helper()
+
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, ts.URL+path, &reader)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Authorization", auth)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if data != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(data); err != nil {
+			t.Fatalf("%s %s: decode: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
@@ -2,14 +2,18 @@ package tests
 
 import (
 	"database/sql"
+	"filmlibrary/pkg/config"
 	"filmlibrary/pkg/handlers"
 	"filmlibrary/pkg/items"
+	"filmlibrary/pkg/lockout"
+	"filmlibrary/pkg/session"
 	"filmlibrary/pkg/users"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
@@ -17,46 +21,7 @@ import (
 )
 
 func PrepareActors(db *sql.DB) {
-	qs := []string{
-		`DROP TABLE IF EXISTS users cascade;`,
-		`DROP TABLE IF EXISTS films cascade;`,
-		`DROP TABLE IF EXISTS film_actor cascade;`,
-		`CREATE TABLE users (
-			id SERIAL PRIMARY KEY,
-			username VARCHAR(50) NOT NULL,
-			role VARCHAR(50) NOT NULL DEFAULT 'user',
-			hashed_password VARCHAR(255) NOT NULL
-		);`,
-
-		`INSERT INTO users (username, role, hashed_password) VALUES
-		('admin', 'admin','$2a$10$GJJT0w7LaC4oOfTygVVi8Ofn8D5kZHTXWdhA8PzscqkK846A2oG.C');`,
-		`DROP TABLE IF EXISTS actors cascade;`,
-		`CREATE TABLE actors (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(100) DEFAULT NULL,
-			gender VARCHAR(10) DEFAULT NULL,
-			date DATE DEFAULT NULL
-		);`,
-		`CREATE TABLE films (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(1000) NOT NULL,
-			description VARCHAR(1000),
-			date INTEGER CHECK (date >= 1900 AND date <= 2200),
-			rating INT CHECK (rating >= 0 AND rating <= 10) DEFAULT NULL
-		);`,
-		`CREATE TABLE film_actor (
-			film_id INTEGER,
-			actor_id INTEGER,
-			PRIMARY KEY (film_id, actor_id)
-		);`,
-	}
-
-	for _, q := range qs {
-		_, err := db.Exec(q)
-		if err != nil {
-			panic(err)
-		}
-	}
+	PrepareSchema(db)
 }
 
 func TestActors(t *testing.T) {
@@ -289,6 +254,40 @@ func TestActors(t *testing.T) {
 			Status: http.StatusOK,
 			Result: CR{"data": CR{"id": 1, "name": "hello", "gender": "", "date": "", "films": nil}},
 		},
+		Case{
+			Path:   "/api/actors/1",
+			Method: http.MethodDelete,
+			Body:   CR{},
+			Status: http.StatusOK,
+			Result: CR{"data": 1},
+		},
+		Case{
+			Path:   "/api/actors/1",
+			Method: http.MethodDelete,
+			Body:   CR{},
+			Status: http.StatusNotFound,
+			Result: CR{"error": "not found"},
+		},
+		Case{
+			Path:   "/api/trash/actors/1/restore",
+			Method: http.MethodPost,
+			Body:   CR{},
+			Status: http.StatusOK,
+			Result: CR{"data": 1},
+		},
+		Case{
+			Path:   "/api/trash/actors/1/restore",
+			Method: http.MethodPost,
+			Body:   CR{},
+			Status: http.StatusNotFound,
+			Result: CR{"error": "not found"},
+		},
+		Case{
+			Path:   "/api/actors/1",
+			Method: http.MethodGet,
+			Status: http.StatusOK,
+			Result: CR{"data": CR{"id": 1, "name": "Mila", "gender": "female", "date": nil, "films": nil}},
+		},
 	}
 
 	runCases(t, ts, db, cases)
@@ -306,10 +305,43 @@ func fakeExplorer(db *sql.DB, logger *zap.SugaredLogger) (http.Handler, error) {
 	}
 	filmHandler := &handlers.FilmsHandler{
 		FilmsRepo: itemRepo,
+		Search:    config.Search{FuzzyThreshold: 0.4},
+		Facets:    config.Facets{TopActors: 10},
 		Logger:    logger,
 	}
+	trashHandler := &handlers.TrashHandler{
+		ItemsRepo: itemRepo,
+		Retention: 720 * time.Hour,
+		Logger:    logger,
+	}
+	key, err := session.NewHMACKey("test", []byte(testSecret))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := session.NewKeys("", time.Hour, 24*time.Hour, key)
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutConfig, err := config.NewLockout()
+	if err != nil {
+		return nil, err
+	}
+	guard := lockout.NewGuard(userRepo, *lockoutConfig, logger)
+
 	userHandler := &handlers.UsersHandler{
 		UserRepo: userRepo,
+		Keys:     keys,
+		Guard:    guard,
+		Logger:   logger,
+	}
+	sessionHandler := &handlers.SessionsHandler{
+		UserRepo: userRepo,
+		Logger:   logger,
+	}
+	accountHandler := &handlers.AccountsHandler{
+		UserRepo: userRepo,
+		Guard:    guard,
 		Logger:   logger,
 	}
 
@@ -317,18 +349,42 @@ func fakeExplorer(db *sql.DB, logger *zap.SugaredLogger) (http.Handler, error) {
 
 	router.HandleFunc("/api/actors", actorHandler.CreateActor).Methods("POST")
 	router.HandleFunc("/api/actors", actorHandler.GetActors).Methods("GET")
+	router.HandleFunc("/api/actors/search", actorHandler.SearchActors).Methods("GET")
 	router.HandleFunc("/api/actors/{ACTOR_ID}", actorHandler.GetActor).Methods("GET")
 	router.HandleFunc("/api/actors/{ACTOR_ID}", actorHandler.UpdateActor).Methods("POST")
+	router.HandleFunc("/api/actors/{ACTOR_ID}", actorHandler.DeleteActor).Methods("DELETE")
 	router.HandleFunc("/api/actors/{ACTOR_ID}/{COLUMN_NAME}", actorHandler.UpdateColumnActor).Methods("POST")
 
 	router.HandleFunc("/api/films/search", filmHandler.SearchFilm).Methods("GET")
 	router.HandleFunc("/api/films", filmHandler.GetFilms).Methods("GET")
 	router.HandleFunc("/api/films", filmHandler.CreateFilm).Methods("POST")
 	router.HandleFunc("/api/films/{FILM_ID}", filmHandler.UpdateFilm).Methods("POST")
+	router.HandleFunc("/api/films/{FILM_ID}", filmHandler.DeleteFilm).Methods("DELETE")
 	router.HandleFunc("/api/films/{FILM_ID}/{COLUMN_NAME}", filmHandler.UpdateColumnFilm).Methods("POST")
 
+	router.HandleFunc("/api/trash", trashHandler.GetTrash).Methods("GET")
+	router.HandleFunc("/api/trash", trashHandler.PurgeTrash).Methods("DELETE")
+	router.HandleFunc("/api/trash/films/{FILM_ID}/restore", trashHandler.RestoreFilm).Methods("POST")
+	router.HandleFunc("/api/trash/actors/{ACTOR_ID}/restore", trashHandler.RestoreActor).Methods("POST")
+
 	router.HandleFunc("/api/login", userHandler.Login).Methods("POST")
 	router.HandleFunc("/api/register", userHandler.Register).Methods("POST")
+	router.HandleFunc("/api/token/refresh", userHandler.Refresh).Methods("POST")
+	router.HandleFunc("/api/logout", userHandler.Logout).Methods("POST")
+
+	router.HandleFunc("/api/me", userHandler.GetMe).Methods("GET")
+	router.HandleFunc("/api/me", userHandler.DeleteMe).Methods("DELETE")
+	router.HandleFunc("/api/me/password", userHandler.ChangePassword).Methods("POST")
+	router.HandleFunc("/api/me/sessions", sessionHandler.GetSessions).Methods("GET")
+	router.HandleFunc("/api/me/sessions/{SESSION_ID}", sessionHandler.RevokeSession).Methods("DELETE")
+	router.HandleFunc("/api/users", accountHandler.GetUsers).Methods("GET")
+	router.HandleFunc("/api/users/{USER_ID}", accountHandler.GetUser).Methods("GET")
+	router.HandleFunc("/api/users/{USER_ID}", accountHandler.DeleteUser).Methods("DELETE")
+	router.HandleFunc("/api/users/{USER_ID}/role", accountHandler.SetRole).Methods("POST")
+	router.HandleFunc("/api/users/{USER_ID}/disable", accountHandler.DisableUser).Methods("POST")
+	router.HandleFunc("/api/users/{USER_ID}/enable", accountHandler.EnableUser).Methods("POST")
+	router.HandleFunc("/api/users/{USER_ID}/unlock", accountHandler.UnlockUser).Methods("POST")
+	router.HandleFunc("/api/users/{USER_ID}/sessions", sessionHandler.RevokeUserSessions).Methods("DELETE")
 
 	return router, nil
 }
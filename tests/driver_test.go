@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+const instrumentedDriverName = "postgres-instrumented"
+
+var (
+	registerInstrumentedDriver sync.Once
+	preparedQueries            int64
+	failingQuery               atomic.Value
+
+	errInjected = errors.New("injected failure")
+)
+
+// instrumentedDriver hides the pq fast paths, so database/sql prepares every
+// statement and each query passes through Prepare exactly once. That lets
+// tests count queries and fail a chosen statement in the middle of a write.
+type instrumentedDriver struct{}
+
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (instrumentedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := pq.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return instrumentedConn{Conn: conn}, nil
+}
+
+func (conn instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	if prefix, _ := failingQuery.Load().(string); prefix != "" && strings.HasPrefix(strings.TrimSpace(query), prefix) {
+		return nil, errInjected
+	}
+
+	atomic.AddInt64(&preparedQueries, 1)
+	return conn.Conn.Prepare(query)
+}
+
+func openInstrumentedDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	registerInstrumentedDriver.Do(func() {
+		sql.Register(instrumentedDriverName, instrumentedDriver{})
+	})
+
+	DSN := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable",
+		user, password, host, dbname)
+
+	db, err := sql.Open(instrumentedDriverName, DSN)
+	if err != nil {
+		tb.Fatalf("open: %v", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		tb.Skipf("postgres is not available: %v", err)
+	}
+
+	return db
+}
+
+// failQueries makes every statement starting with prefix fail until the test ends.
+func failQueries(tb testing.TB, prefix string) {
+	failingQuery.Store(prefix)
+	tb.Cleanup(func() { failingQuery.Store("") })
+}
+
+func countQueries(tb testing.TB, f func()) int64 {
+	tb.Helper()
+
+	start := atomic.LoadInt64(&preparedQueries)
+	f()
+	return atomic.LoadInt64(&preparedQueries) - start
+}
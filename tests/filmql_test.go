@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"errors"
+	"filmlibrary/pkg/filmql"
+	"reflect"
+	"testing"
+)
+
+func TestFilmQLParse(t *testing.T) {
+	cases := []struct {
+		query string
+		node  filmql.Node
+	}{
+		{
+			`actor:"Tom Hanks" year:>=2000 rating:>7 -title:sequel`,
+			filmql.And{Nodes: []filmql.Node{
+				filmql.Match{Field: filmql.FieldActor, Op: filmql.OpContains, Text: "Tom Hanks"},
+				filmql.Match{Field: filmql.FieldYear, Op: filmql.OpGreaterEqual, Number: 2000},
+				filmql.Match{Field: filmql.FieldRating, Op: filmql.OpGreater, Number: 7},
+				filmql.Not{Node: filmql.Match{Field: filmql.FieldTitle, Op: filmql.OpContains, Text: "sequel"}},
+			}},
+		},
+		{
+			`spider-man year:2002`,
+			filmql.And{Nodes: []filmql.Node{
+				filmql.Text{Text: "spider-man"},
+				filmql.Match{Field: filmql.FieldYear, Op: filmql.OpEqual, Number: 2002},
+			}},
+		},
+		{
+			`name:=Heat OR (NOT rating:<5 AND "heist movie")`,
+			filmql.Or{Nodes: []filmql.Node{
+				filmql.Match{Field: filmql.FieldTitle, Op: filmql.OpEqual, Text: "Heat"},
+				filmql.And{Nodes: []filmql.Node{
+					filmql.Not{Node: filmql.Match{Field: filmql.FieldRating, Op: filmql.OpLess, Number: 5}},
+					filmql.Text{Text: "heist movie"},
+				}},
+			}},
+		},
+	}
+
+	for _, c := range cases {
+		node, err := filmql.Parse(c.query)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", c.query, err)
+		}
+		if !reflect.DeepEqual(node, c.node) {
+			t.Fatalf("Parse(%s): expected %#v, got %#v", c.query, c.node, node)
+		}
+	}
+}
+
+func TestFilmQLParseErrors(t *testing.T) {
+	cases := []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{"", 1, "empty query"},
+		{"genre:drama", 1, `unknown field "genre"`},
+		{"year:>=20x0", 8, `year must be a whole number, got "20x0"`},
+		{"title:>alien", 7, `title does not support ">"`},
+		{"actor:", 7, "expected actor value, got end of query"},
+		{`Властелин actor:"Вигго`, 17, "unterminated string"},
+		{"(year:2000", 11, `expected ")", got end of query`},
+		{"year:2000)", 10, `unexpected ")"`},
+		{"alien OR", 9, "unexpected end of query"},
+	}
+
+	for _, c := range cases {
+		_, err := filmql.Parse(c.query)
+
+		var syntaxErr *filmql.Error
+		if !errors.As(err, &syntaxErr) {
+			t.Fatalf("Parse(%s): expected *filmql.Error, got %v", c.query, err)
+		}
+		if syntaxErr.Pos != c.pos || syntaxErr.Msg != c.msg {
+			t.Fatalf("Parse(%s): expected %q at %d, got %q at %d", c.query, c.msg, c.pos, syntaxErr.Msg, syntaxErr.Pos)
+		}
+	}
+}
+
+func TestFilmQLSQL(t *testing.T) {
+	node, err := filmql.Parse(`title:"100%" -rating:>7 OR year:1999`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	condition, args := filmql.SQL(node)
+	wantCondition := `((name ILIKE ? ESCAPE '\' AND (rating > ?) IS NOT TRUE) OR date = ?)`
+	if condition != wantCondition {
+		t.Fatalf("SQL: expected %s, got %s", wantCondition, condition)
+	}
+	if wantArgs := []interface{}{`%100\%%`, int64(7), int64(1999)}; !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("SQL: expected args %v, got %v", wantArgs, args)
+	}
+}
@@ -13,45 +13,7 @@ import (
 )
 
 func PrepareFilms(db *sql.DB) {
-	qs := []string{
-		`DROP TABLE IF EXISTS users;`,
-		`DROP TABLE IF EXISTS film_actor cascade;`,
-		`DROP TABLE IF EXISTS films cascade;`,
-		`DROP TABLE IF EXISTS actors cascade;`,
-		`CREATE TABLE users (
-			id SERIAL PRIMARY KEY,
-			username VARCHAR(50) NOT NULL,
-			role VARCHAR(50) NOT NULL DEFAULT 'user',
-			hashed_password VARCHAR(255) NOT NULL
-		);`,
-		`INSERT INTO users (username, role, hashed_password) VALUES
-		('admin', 'admin','$2a$10$GJJT0w7LaC4oOfTygVVi8Ofn8D5kZHTXWdhA8PzscqkK846A2oG.C');`,
-		`CREATE TABLE actors (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(100) DEFAULT NULL,
-			gender VARCHAR(10) DEFAULT NULL,
-			date DATE DEFAULT NULL
-		);`,
-		`CREATE TABLE films (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(1000) NOT NULL,
-			description VARCHAR(1000),
-			date INTEGER CHECK (date >= 1900 AND date <= 2200),
-			rating INT CHECK (rating >= 0 AND rating <= 10) DEFAULT NULL
-		);`,
-		`CREATE TABLE film_actor (
-			film_id INTEGER,
-			actor_id INTEGER,
-			PRIMARY KEY (film_id, actor_id)
-		);`,
-	}
-
-	for _, q := range qs {
-		_, err := db.Exec(q)
-		if err != nil {
-			panic(err)
-		}
-	}
+	PrepareSchema(db)
 }
 
 func TestFilms(t *testing.T) {
@@ -85,6 +47,11 @@ func TestFilms(t *testing.T) {
 
 	PrepareFilms(db)
 
+	_, err = db.Exec("INSERT INTO actors (name) VALUES ('Тоби Магуайр'), ('Эндрю Гарфилд')")
+	if err != nil {
+		panic(err)
+	}
+
 	handler, err := fakeExplorer(db, logger) //nolint:typecheck
 	if err != nil {
 		panic(err)
@@ -141,13 +108,34 @@ func TestFilms(t *testing.T) {
 			Status: http.StatusBadRequest,
 			Result: CR{"error": "empty search"},
 		},
+		{
+			Path:   "/api/films/search",
+			Query:  "query=Властелен&mode=fuzzy",
+			Method: http.MethodGet,
+			Body:   CR{},
+			Status: http.StatusOK,
+			Result: CR{"data": []interface{}{
+				CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10, "score": 0.7},
+				CR{"actors": nil, "date": 2003, "description": "фильм", "id": 2, "name": "Властелин колец: Возвращение короля", "rating": 9, "score": 0.7}}},
+		},
 		{
 			Path:   "/api/films/search",
 			Query:  "query=Властелин",
 			Method: http.MethodGet,
 			Body:   CR{},
 			Status: http.StatusOK,
-			Result: CR{"data": []interface{}{CR{"actors": nil, "date": 2003, "description": "фильм", "id": 2, "name": "Властелин колец: Возвращение короля", "rating": 9}, CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10}}},
+			Result: CR{"data": []interface{}{
+				CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10, "snippet": "<b>Властелин</b> колец: Две крепости. фильм"},
+				CR{"actors": nil, "date": 2003, "description": "фильм", "id": 2, "name": "Властелин колец: Возвращение короля", "rating": 9, "snippet": "<b>Властелин</b> колец: Возвращение короля. фильм"}}},
+		},
+		{
+			Path:   "/api/films/search",
+			Query:  "query=колец+возвращение",
+			Method: http.MethodGet,
+			Body:   CR{},
+			Status: http.StatusOK,
+			Result: CR{"data": []interface{}{
+				CR{"actors": nil, "date": 2003, "description": "фильм", "id": 2, "name": "Властелин колец: Возвращение короля", "rating": 9, "snippet": "Властелин <b>колец</b>: <b>Возвращение</b> короля. фильм"}}},
 		},
 		{
 			Path:   "/api/films",
@@ -155,7 +143,7 @@ func TestFilms(t *testing.T) {
 			Method: http.MethodGet,
 			Body:   CR{},
 			Status: http.StatusOK,
-			Result: CR{"data": []interface{}{CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10},
+			Result: CR{"total": 2, "data": []interface{}{CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10},
 				CR{"actors": nil, "date": 2003, "description": "фильм", "id": 2, "name": "Властелин колец: Возвращение короля", "rating": 9}}},
 		},
 		{
@@ -164,7 +152,7 @@ func TestFilms(t *testing.T) {
 			Method: http.MethodGet,
 			Body:   CR{},
 			Status: http.StatusOK,
-			Result: CR{"data": []interface{}{CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10},
+			Result: CR{"total": 2, "data": []interface{}{CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10},
 				CR{"actors": nil, "date": 2003, "description": "фильм", "id": 2, "name": "Властелин колец: Возвращение короля", "rating": 9}}},
 		},
 		{
@@ -189,7 +177,7 @@ func TestFilms(t *testing.T) {
 			Method: http.MethodGet,
 			Body:   CR{},
 			Status: http.StatusOK,
-			Result: CR{"data": []interface{}{CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10},
+			Result: CR{"total": 2, "data": []interface{}{CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10},
 				CR{"actors": nil, "date": 2003, "description": "фильм", "id": 2, "name": "Властелин колец: Возвращение короля", "rating": 9}}},
 		},
 		{
@@ -198,7 +186,7 @@ func TestFilms(t *testing.T) {
 			Method: http.MethodGet,
 			Body:   CR{},
 			Status: http.StatusOK,
-			Result: CR{"data": []interface{}{CR{"actors": nil, "date": 2003, "description": "фильм", "id": 2, "name": "Властелин колец: Возвращение короля", "rating": 9}, CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10}}},
+			Result: CR{"total": 2, "data": []interface{}{CR{"actors": nil, "date": 2003, "description": "фильм", "id": 2, "name": "Властелин колец: Возвращение короля", "rating": 9}, CR{"actors": nil, "date": 2002, "description": "фильм", "id": 1, "name": "Властелин колец: Две крепости", "rating": 10}}},
 		},
 		{
 			Path:   "/api/films",
@@ -381,13 +369,45 @@ func TestFilms(t *testing.T) {
 				"Date":        2002,
 				"Rating":      10,
 				"Actors": []CR{
-					{"ID": 0, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
-					{"ID": 1, "Name": "Эндрю Гарфилд", "gender": "Мужской", "Date": ""},
+					{"ID": 1, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
+					{"ID": 2, "Name": "Эндрю Гарфилд", "gender": "Мужской", "Date": ""},
 				},
 			},
 			Status: http.StatusOK,
 			Result: CR{"data": 1},
 		},
+		{
+			Path:   "/api/films/1/Actors",
+			Method: http.MethodPost,
+			Body: CR{
+				"Actors": []CR{
+					{"ID": 1000, "Name": "Никто", "gender": "", "Date": ""},
+				},
+			},
+			Status: http.StatusUnprocessableEntity,
+			Result: CR{"error": "actor not exist"},
+		},
+		{
+			Path:   "/api/films/1/Actors",
+			Method: http.MethodPost,
+			Body: CR{
+				"Actors": []CR{
+					{"ID": 1, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
+					{"ID": 1, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
+				},
+			},
+			Status: http.StatusConflict,
+			Result: CR{"error": "actor already in film cast"},
+		},
+		{
+			Path:   "/api/films/1/Rating",
+			Method: http.MethodPost,
+			Body: CR{
+				"Rating": 11,
+			},
+			Status: http.StatusUnprocessableEntity,
+			Result: CR{"error": "incorrect film rating"},
+		},
 		{
 			Path:   "/api/films/1",
 			Method: http.MethodPost,
@@ -397,8 +417,8 @@ func TestFilms(t *testing.T) {
 				"Date":        2002,
 				"Rating":      10,
 				"Actors": []CR{
-					{"ID": 0, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
-					{"ID": 1, "Name": "Эндрю Гарфилд", "gender": "Мужской", "Date": ""},
+					{"ID": 1, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
+					{"ID": 2, "Name": "Эндрю Гарфилд", "gender": "Мужской", "Date": ""},
 				},
 			},
 			Status: http.StatusOK,
@@ -412,8 +432,8 @@ func TestFilms(t *testing.T) {
 				"Description": "film",
 				"Date":        2010,
 				"Actors": []CR{
-					{"ID": 0, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
-					{"ID": 1, "Name": "Эндрю Гарфилд", "gender": "Мужской", "Date": ""},
+					{"ID": 1, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
+					{"ID": 2, "Name": "Эндрю Гарфилд", "gender": "Мужской", "Date": ""},
 				},
 			},
 			Status: http.StatusCreated,
@@ -425,8 +445,8 @@ func TestFilms(t *testing.T) {
 			Body: CR{
 				"Name": "Человек-паук 2",
 				"Actors": []CR{
-					{"ID": 0, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
-					{"ID": 1, "Name": "Эндрю Гарфилд", "gender": "Мужской", "Date": ""},
+					{"ID": 1, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
+					{"ID": 2, "Name": "Эндрю Гарфилд", "gender": "Мужской", "Date": ""},
 				},
 			},
 			Status: http.StatusCreated,
@@ -438,13 +458,78 @@ func TestFilms(t *testing.T) {
 			Body: CR{
 				"Name": "Человек-паук 3",
 				"Actors": []CR{
-					{"ID": 0, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
-					{"ID": 1, "Name": "Эндрю Гарфилд", "gender": "Мужской", "Date": ""},
+					{"ID": 1, "Name": "Тоби Магуайр", "gender": "Мужской", "Date": ""},
+					{"ID": 2, "Name": "Эндрю Гарфилд", "gender": "Мужской", "Date": ""},
 				},
 			},
 			Status: http.StatusCreated,
 			Result: CR{"data": 7},
 		},
+		{
+			Path:   "/api/films/7",
+			Method: http.MethodDelete,
+			Body:   CR{},
+			Status: http.StatusOK,
+			Result: CR{"data": 7},
+		},
+		{
+			Path:   "/api/films/7",
+			Method: http.MethodDelete,
+			Body:   CR{},
+			Status: http.StatusNotFound,
+			Result: CR{"error": "not found"},
+		},
+		{
+			Path:   "/api/trash/films/7/restore",
+			Method: http.MethodPost,
+			Body:   CR{},
+			Status: http.StatusOK,
+			Result: CR{"data": 7},
+		},
+		{
+			Path:   "/api/trash/films/7/restore",
+			Method: http.MethodPost,
+			Body:   CR{},
+			Status: http.StatusNotFound,
+			Result: CR{"error": "not found"},
+		},
+		{
+			Path:   "/api/films/7",
+			Method: http.MethodDelete,
+			Body:   CR{},
+			Status: http.StatusOK,
+			Result: CR{"data": 7},
+		},
+		{
+			Path:   "/api/trash",
+			Query:  "older_than=forever",
+			Method: http.MethodDelete,
+			Body:   CR{},
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "incorrect older_than"},
+		},
+		{
+			Path:   "/api/trash",
+			Query:  "older_than=0s",
+			Method: http.MethodDelete,
+			Body:   CR{},
+			Status: http.StatusOK,
+			Result: CR{"data": 1},
+		},
+		{
+			Path:   "/api/trash/films/7/restore",
+			Method: http.MethodPost,
+			Body:   CR{},
+			Status: http.StatusNotFound,
+			Result: CR{"error": "not found"},
+		},
+		{
+			Path:   "/api/films/oovrv",
+			Method: http.MethodDelete,
+			Body:   CR{},
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "strconv.ParseUint: parsing \"oovrv\": invalid syntax"},
+		},
 	}
 
 	runCases(t, ts, db, cases)
@@ -0,0 +1,923 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/filmql"
+	"filmlibrary/pkg/items"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// itemRepoFactory returns an empty repository for every subtest.
+type itemRepoFactory func(t *testing.T) items.ItemRepo
+
+func TestItemMapRepository(t *testing.T) {
+	runItemRepoConformance(t, func(t *testing.T) items.ItemRepo {
+		return items.NewMapRepo()
+	})
+}
+
+func TestItemMemoryRepository(t *testing.T) {
+	DSN := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable",
+		user, password, host, dbname)
+
+	db, err := sql.Open("postgres", DSN)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		t.Skipf("postgres is not available: %v", err)
+	}
+
+	runItemRepoConformance(t, func(t *testing.T) items.ItemRepo {
+		PrepareFilms(db)
+		return items.NewMemoryRepo(db)
+	})
+}
+
+func runItemRepoConformance(t *testing.T, newRepo itemRepoFactory) {
+	t.Run("films", func(t *testing.T) { testRepoFilms(t, newRepo(t)) })
+	t.Run("films order", func(t *testing.T) { testRepoFilmsOrder(t, newRepo(t)) })
+	t.Run("films pages", func(t *testing.T) { testRepoFilmsPages(t, newRepo(t)) })
+	t.Run("films filter", func(t *testing.T) { testRepoFilmsFilter(t, newRepo(t)) })
+	t.Run("film columns", func(t *testing.T) { testRepoFilmColumns(t, newRepo(t)) })
+	t.Run("cast", func(t *testing.T) { testRepoCast(t, newRepo(t)) })
+	t.Run("atomic writes", func(t *testing.T) { testRepoAtomicWrites(t, newRepo(t)) })
+	t.Run("search", func(t *testing.T) { testRepoSearch(t, newRepo(t)) })
+	t.Run("fuzzy search", func(t *testing.T) { testRepoFuzzySearch(t, newRepo(t)) })
+	t.Run("translit search", func(t *testing.T) { testRepoTranslitSearch(t, newRepo(t)) })
+	t.Run("query search", func(t *testing.T) { testRepoQuerySearch(t, newRepo(t)) })
+	t.Run("facets", func(t *testing.T) { testRepoFacets(t, newRepo(t)) })
+	t.Run("actors", func(t *testing.T) { testRepoActors(t, newRepo(t)) })
+	t.Run("actor search", func(t *testing.T) { testRepoActorSearch(t, newRepo(t)) })
+	t.Run("suggest", func(t *testing.T) { testRepoSuggest(t, newRepo(t)) })
+	t.Run("trash", func(t *testing.T) { testRepoTrash(t, newRepo(t)) })
+	t.Run("concurrent writes", func(t *testing.T) { testRepoConcurrentWrites(t, newRepo(t)) })
+}
+
+func testRepoFilms(t *testing.T, repo items.ItemRepo) {
+	id := mustCreateFilm(t, repo, items.Film{Name: "Alien", Description: "space", Date: 1979, Rating: 8})
+	if id != 1 {
+		t.Fatalf("expected id 1, got %d", id)
+	}
+
+	film, err := repo.GetFilmByID(id)
+	if err != nil {
+		t.Fatalf("GetFilmByID: %v", err)
+	}
+	if film.Name != "Alien" || film.Description != "space" || toInt(film.Date) != 1979 || toInt(film.Rating) != 8 {
+		t.Fatalf("unexpected film %#v", film)
+	}
+
+	film.Name = "Aliens"
+	film.Date = 1986
+	if err := repo.UpdateFilm(film); err != nil {
+		t.Fatalf("UpdateFilm: %v", err)
+	}
+
+	film, err = repo.GetFilmByID(id)
+	if err != nil {
+		t.Fatalf("GetFilmByID: %v", err)
+	}
+	if film.Name != "Aliens" || toInt(film.Date) != 1986 {
+		t.Fatalf("film not updated: %#v", film)
+	}
+
+	if _, err := repo.GetFilmByID(1000); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	if err := repo.UpdateFilm(items.Film{ID: 1000, Name: "ghost"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	if _, err := repo.CreateFilm(items.Film{Name: "bad", Rating: 11}); err == nil {
+		t.Fatalf("expected rating check error")
+	}
+}
+
+func testRepoFilmsOrder(t *testing.T, repo items.ItemRepo) {
+	mustCreateFilm(t, repo, items.Film{Name: "b", Date: 2001, Rating: 7})
+	mustCreateFilm(t, repo, items.Film{Name: "a", Date: 2003, Rating: 9})
+	mustCreateFilm(t, repo, items.Film{Name: "c", Date: 2002})
+
+	cases := []struct {
+		field string
+		order int
+		ids   []uint32
+	}{
+		{"rating", -1, []uint32{3, 2, 1}},
+		{"rating", 1, []uint32{1, 2, 3}},
+		{"name", 1, []uint32{2, 1, 3}},
+		{"name", -1, []uint32{3, 1, 2}},
+		{"date", 1, []uint32{1, 3, 2}},
+		{"date", -1, []uint32{2, 3, 1}},
+	}
+
+	for _, c := range cases {
+		films, total, err := repo.GetFilms(c.field, c.order, items.FilmFilter{}, items.Page{})
+		if err != nil {
+			t.Fatalf("GetFilms(%s, %d): %v", c.field, c.order, err)
+		}
+		if got := filmIDs(films); !equalIDs(got, c.ids) {
+			t.Fatalf("GetFilms(%s, %d): expected %v, got %v", c.field, c.order, c.ids, got)
+		}
+		if total != len(c.ids) {
+			t.Fatalf("GetFilms(%s, %d): expected total %d, got %d", c.field, c.order, len(c.ids), total)
+		}
+	}
+}
+
+func testRepoFilmsPages(t *testing.T, repo items.ItemRepo) {
+	ratings := []interface{}{7, nil, 9, 7, nil, 3, 7}
+	for i, rating := range ratings {
+		mustCreateFilm(t, repo, items.Film{Name: fmt.Sprintf("film %d", i), Rating: rating})
+	}
+
+	for _, order := range []int{-1, 1} {
+		all, _, err := repo.GetFilms("rating", order, items.FilmFilter{}, items.Page{})
+		if err != nil {
+			t.Fatalf("GetFilms: %v", err)
+		}
+
+		var paged []items.Film
+		page := items.Page{Limit: 2}
+		for {
+			films, total, err := repo.GetFilms("rating", order, items.FilmFilter{}, page)
+			if err != nil {
+				t.Fatalf("GetFilms(%v): %v", page, err)
+			}
+			if total != len(ratings) {
+				t.Fatalf("expected total %d, got %d", len(ratings), total)
+			}
+			if len(films) == 0 {
+				break
+			}
+
+			paged = append(paged, films...)
+			last := films[len(films)-1]
+			page.After = &items.Cursor{ID: last.ID, Value: last.Rating}
+		}
+
+		if got, want := filmIDs(paged), filmIDs(all); !equalIDs(got, want) {
+			t.Fatalf("order %d: pages %v do not match listing %v", order, got, want)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		mustCreateActor(t, repo, items.Actor{Name: fmt.Sprintf("actor %d", i), Date: ""})
+	}
+
+	actors, total, err := repo.GetActors(items.Page{Limit: 2, After: &items.Cursor{ID: 1}})
+	if err != nil {
+		t.Fatalf("GetActors: %v", err)
+	}
+	if got := actorIDs(actors); !equalIDs(got, []uint32{2, 3}) || total != 3 {
+		t.Fatalf("expected actors [2 3] of 3, got %v of %d", got, total)
+	}
+}
+
+func testRepoFilmsFilter(t *testing.T, repo items.ItemRepo) {
+	ripley := mustCreateActor(t, repo, items.Actor{Name: "Ripley", Date: ""})
+	bishop := mustCreateActor(t, repo, items.Actor{Name: "Bishop", Date: ""})
+
+	mustCreateFilm(t, repo, items.Film{Name: "Alien", Date: 1979, Rating: 8, Actors: []items.Actor{{ID: ripley}}})
+	mustCreateFilm(t, repo, items.Film{Name: "Aliens", Date: 1986, Rating: 9, Actors: []items.Actor{{ID: ripley}, {ID: bishop}}})
+	mustCreateFilm(t, repo, items.Film{Name: "Alien 3", Date: 1992, Actors: []items.Actor{{ID: bishop}}})
+	mustCreateFilm(t, repo, items.Film{Name: "100%_Alien", Rating: 2})
+
+	year := func(n int64) *int64 { return &n }
+
+	cases := []struct {
+		name   string
+		filter items.FilmFilter
+		ids    []uint32
+	}{
+		{"years", items.FilmFilter{DateFrom: year(1980), DateTo: year(1992)}, []uint32{2, 3}},
+		{"rating", items.FilmFilter{RatingFrom: year(8)}, []uint32{1, 2}},
+		{"all actors", items.FilmFilter{ActorIDs: []uint32{ripley, bishop}}, []uint32{2}},
+		{"repeated actor", items.FilmFilter{ActorIDs: []uint32{ripley, ripley}}, []uint32{1, 2}},
+		{"any actor", items.FilmFilter{ActorIDs: []uint32{ripley, bishop}, AnyActor: true}, []uint32{1, 2, 3}},
+		{"name prefix", items.FilmFilter{NamePrefix: "aliens"}, []uint32{2}},
+		{"wildcards are literal", items.FilmFilter{NamePrefix: "100%_"}, []uint32{4}},
+		{"no wildcard match", items.FilmFilter{NamePrefix: "1_0"}, nil},
+		{"combined", items.FilmFilter{NamePrefix: "Alien", DateTo: year(1990), ActorIDs: []uint32{bishop}}, []uint32{2}},
+	}
+
+	for _, c := range cases {
+		films, total, err := repo.GetFilms("date", 1, c.filter, items.Page{})
+		if err != nil {
+			t.Fatalf("[%s] GetFilms: %v", c.name, err)
+		}
+		if got := filmIDs(films); !equalIDs(got, c.ids) {
+			t.Fatalf("[%s] expected %v, got %v", c.name, c.ids, got)
+		}
+		if total != len(c.ids) {
+			t.Fatalf("[%s] expected total %d, got %d", c.name, len(c.ids), total)
+		}
+	}
+}
+
+func testRepoFilmColumns(t *testing.T, repo items.ItemRepo) {
+	id := mustCreateFilm(t, repo, items.Film{Name: "Heat", Date: 1995, Rating: 8})
+
+	if err := repo.UpdateColumnFilm(items.Film{ID: id, Rating: 9, Name: "ignored"}, "Rating"); err != nil {
+		t.Fatalf("UpdateColumnFilm: %v", err)
+	}
+
+	film, err := repo.GetFilmByID(id)
+	if err != nil {
+		t.Fatalf("GetFilmByID: %v", err)
+	}
+	if film.Name != "Heat" || toInt(film.Rating) != 9 {
+		t.Fatalf("unexpected film %#v", film)
+	}
+
+	if err := repo.UpdateColumnFilm(items.Film{ID: id, Date: 1800}, "Date"); err == nil {
+		t.Fatalf("expected date check error")
+	}
+
+	if err := repo.UpdateColumnFilm(items.Film{ID: 1000, Rating: 1}, "Rating"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func testRepoCast(t *testing.T, repo items.ItemRepo) {
+	first := mustCreateActor(t, repo, items.Actor{Name: "Ripley", Gender: "female", Date: ""})
+	second := mustCreateActor(t, repo, items.Actor{Name: "Bishop", Gender: "male", Date: ""})
+
+	filmID := mustCreateFilm(t, repo, items.Film{Name: "Aliens", Actors: []items.Actor{{ID: first}, {ID: second}}})
+
+	film, err := repo.GetFilmByID(filmID)
+	if err != nil {
+		t.Fatalf("GetFilmByID: %v", err)
+	}
+	if got := sortedIDs(actorIDs(film.Actors)); !equalIDs(got, []uint32{first, second}) {
+		t.Fatalf("expected cast %v, got %v", []uint32{first, second}, got)
+	}
+
+	films, err := repo.GetActorFilms(items.Actor{ID: first})
+	if err != nil {
+		t.Fatalf("GetActorFilms: %v", err)
+	}
+	if got := filmIDs(films); !equalIDs(got, []uint32{filmID}) {
+		t.Fatalf("expected films %v, got %v", []uint32{filmID}, got)
+	}
+
+	if err := repo.InsertActors(filmID, []items.Actor{{ID: first}}); err == nil {
+		t.Fatalf("expected duplicate cast error")
+	}
+
+	if err := repo.DeleteActors(filmID); err != nil {
+		t.Fatalf("DeleteActors: %v", err)
+	}
+	if err := repo.InsertActors(filmID, []items.Actor{{ID: second}}); err != nil {
+		t.Fatalf("InsertActors: %v", err)
+	}
+
+	actors, err := repo.ActorsByFilm(items.Film{ID: filmID})
+	if err != nil {
+		t.Fatalf("ActorsByFilm: %v", err)
+	}
+	if got := actorIDs(actors); !equalIDs(got, []uint32{second}) {
+		t.Fatalf("expected cast %v, got %v", []uint32{second}, got)
+	}
+
+	if err := repo.UpdateFilm(items.Film{ID: filmID, Name: "Aliens", Actors: []items.Actor{{ID: first}}}); err != nil {
+		t.Fatalf("UpdateFilm: %v", err)
+	}
+
+	actors, err = repo.ActorsByFilm(items.Film{ID: filmID})
+	if err != nil {
+		t.Fatalf("ActorsByFilm: %v", err)
+	}
+	if got := actorIDs(actors); !equalIDs(got, []uint32{first}) {
+		t.Fatalf("expected cast %v, got %v", []uint32{first}, got)
+	}
+
+	if err := repo.InsertActors(filmID, []items.Actor{{ID: 1000}}); err == nil || err.Error() != errs.ActorNotExist {
+		t.Fatalf("expected %q, got %v", errs.ActorNotExist, err)
+	}
+	if err := repo.InsertActors(1000, []items.Actor{{ID: first}}); err == nil || err.Error() != errs.FilmNotExist {
+		t.Fatalf("expected %q, got %v", errs.FilmNotExist, err)
+	}
+	if _, err := repo.CreateFilm(items.Film{Name: "Alien 3", Actors: []items.Actor{{ID: 1000}}}); err == nil || err.Error() != errs.ActorNotExist {
+		t.Fatalf("expected %q, got %v", errs.ActorNotExist, err)
+	}
+	if _, err := repo.CreateFilm(items.Film{Name: "Alien 3", Rating: 11}); err == nil || err.Error() != errs.FilmRatingError {
+		t.Fatalf("expected %q, got %v", errs.FilmRatingError, err)
+	}
+}
+
+// testRepoAtomicWrites repeats an actor in a cast, so the write fails on the
+// second film_actor row after the film row and the old cast were touched.
+func testRepoAtomicWrites(t *testing.T, repo items.ItemRepo) {
+	first := mustCreateActor(t, repo, items.Actor{Name: "Ripley", Date: ""})
+	second := mustCreateActor(t, repo, items.Actor{Name: "Bishop", Date: ""})
+	broken := []items.Actor{{ID: second}, {ID: second}}
+
+	if _, err := repo.CreateFilm(items.Film{Name: "Aliens", Actors: broken}); err == nil {
+		t.Fatalf("CreateFilm: expected duplicate cast error")
+	}
+	if _, total, _ := repo.GetFilms("rating", -1, items.FilmFilter{}, items.Page{}); total != 0 {
+		t.Fatalf("CreateFilm left a film without cast: %d films", total)
+	}
+
+	filmID := mustCreateFilm(t, repo, items.Film{Name: "Alien", Rating: 8, Actors: []items.Actor{{ID: first}}})
+
+	if err := repo.UpdateFilm(items.Film{ID: filmID, Name: "Aliens", Rating: 9, Actors: broken}); err == nil {
+		t.Fatalf("UpdateFilm: expected duplicate cast error")
+	}
+	if err := repo.ReplaceActors(filmID, broken); err == nil {
+		t.Fatalf("ReplaceActors: expected duplicate cast error")
+	}
+
+	film, err := repo.GetFilmByID(filmID)
+	if err != nil {
+		t.Fatalf("GetFilmByID: %v", err)
+	}
+	if film.Name != "Alien" || toInt(film.Rating) != 8 {
+		t.Fatalf("UpdateFilm was not rolled back: %#v", film)
+	}
+	if got := actorIDs(film.Actors); !equalIDs(got, []uint32{first}) {
+		t.Fatalf("cast was not rolled back: %v", got)
+	}
+
+	if err := repo.ReplaceActors(filmID, []items.Actor{{ID: second}}); err != nil {
+		t.Fatalf("ReplaceActors: %v", err)
+	}
+	if actors, _ := repo.ActorsByFilm(items.Film{ID: filmID}); !equalIDs(actorIDs(actors), []uint32{second}) {
+		t.Fatalf("expected cast %v, got %v", []uint32{second}, actorIDs(actors))
+	}
+
+	if err := repo.ReplaceActors(1000, nil); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func testRepoSearch(t *testing.T, repo items.ItemRepo) {
+	actorID := mustCreateActor(t, repo, items.Actor{Name: "Sigourney Weaver", Gender: "female", Date: ""})
+
+	alien := mustCreateFilm(t, repo, items.Film{Name: "Alien", Actors: []items.Actor{{ID: actorID}}})
+	aliens := mustCreateFilm(t, repo, items.Film{Name: "Aliens", Description: "marines against aliens"})
+	heat := mustCreateFilm(t, repo, items.Film{Name: "Heat", Description: "a heist that meets an alien"})
+
+	cases := []struct {
+		query string
+		ids   []uint32
+	}{
+		{"alien", []uint32{aliens, alien, heat}},
+		{"WEAVER", []uint32{alien}},
+		{"heist", []uint32{heat}},
+		{"alien weaver", []uint32{alien}},
+		{"matrix", nil},
+	}
+
+	for _, c := range cases {
+		films, err := repo.SearchFilm(c.query)
+		if err != nil {
+			t.Fatalf("SearchFilm(%s): %v", c.query, err)
+		}
+
+		var got []uint32
+		for _, film := range films {
+			got = append(got, film.ID)
+			if !strings.Contains(film.Snippet, "<b>") {
+				t.Fatalf("SearchFilm(%s): no highlight in %q", c.query, film.Snippet)
+			}
+		}
+		if !equalIDs(got, c.ids) {
+			t.Fatalf("SearchFilm(%s): expected %v, got %v", c.query, c.ids, got)
+		}
+	}
+}
+
+func testRepoFuzzySearch(t *testing.T, repo items.ItemRepo) {
+	terminator := mustCreateFilm(t, repo, items.Film{Name: "Terminator"})
+	sequel := mustCreateFilm(t, repo, items.Film{Name: "Terminator 2"})
+	mustCreateFilm(t, repo, items.Film{Name: "Heat"})
+
+	if films, err := repo.SearchFilm("terninator"); err != nil || len(films) != 0 {
+		t.Fatalf("SearchFilm(terninator): expected no films, got %v, %v", films, err)
+	}
+
+	films, err := repo.FuzzySearchFilm("Terninator", 0.4)
+	if err != nil {
+		t.Fatalf("FuzzySearchFilm: %v", err)
+	}
+
+	var got []uint32
+	for _, film := range films {
+		got = append(got, film.ID)
+		if film.Score < 0.4 || film.Score > 1 {
+			t.Fatalf("FuzzySearchFilm: score %v out of range", film.Score)
+		}
+	}
+	if want := []uint32{terminator, sequel}; !equalIDs(got, want) {
+		t.Fatalf("FuzzySearchFilm: expected %v, got %v", want, got)
+	}
+
+	if films, _ := repo.FuzzySearchFilm("Terninator", 0.9); len(films) != 0 {
+		t.Fatalf("FuzzySearchFilm: expected no films over 0.9, got %v", films)
+	}
+}
+
+func testRepoTranslitSearch(t *testing.T, repo items.ItemRepo) {
+	hanks := mustCreateActor(t, repo, items.Actor{Name: "Том Хэнкс", Gender: "male", Date: ""})
+	gump := mustCreateFilm(t, repo, items.Film{Name: "Forrest Gump", Actors: []items.Actor{{ID: hanks}}})
+	brother := mustCreateFilm(t, repo, items.Film{Name: "Брат"})
+	mustCreateFilm(t, repo, items.Film{Name: "Heat"})
+
+	cases := []struct {
+		query string
+		ids   []uint32
+	}{
+		{"Tom Hanks", []uint32{gump}},
+		{"Brat", []uint32{brother}},
+		{"Форрест Гамп", []uint32{gump}},
+		{"Хит", nil},
+	}
+
+	for _, c := range cases {
+		films, err := repo.SearchFilm(c.query)
+		if err != nil {
+			t.Fatalf("SearchFilm(%s): %v", c.query, err)
+		}
+
+		var got []uint32
+		for _, film := range films {
+			got = append(got, film.ID)
+		}
+		if !equalIDs(got, c.ids) {
+			t.Fatalf("SearchFilm(%s): expected %v, got %v", c.query, c.ids, got)
+		}
+	}
+
+	actors, err := repo.SearchActors(items.ActorFilter{Name: "Tom Hanks"})
+	if err != nil || len(actors) != 1 || actors[0].ID != hanks {
+		t.Fatalf("SearchActors(Tom Hanks): expected [%d], got %v, %v", hanks, actors, err)
+	}
+
+	if err := repo.UpdateColumnActor(items.Actor{ID: hanks, Name: "Мэтт Дэймон"}, "Name"); err != nil {
+		t.Fatalf("UpdateColumnActor: %v", err)
+	}
+	if actors, _ := repo.SearchActors(items.ActorFilter{Name: "Tom Hanks"}); len(actors) != 0 {
+		t.Fatalf("SearchActors(Tom Hanks): expected no actors after rename, got %v", actors)
+	}
+	if actors, _ := repo.SearchActors(items.ActorFilter{Name: "Matt Damon"}); len(actors) != 1 {
+		t.Fatalf("SearchActors(Matt Damon): expected the renamed actor, got %v", actors)
+	}
+
+	if err := repo.UpdateFilm(items.Film{ID: brother, Name: "Брат 2"}); err != nil {
+		t.Fatalf("UpdateFilm: %v", err)
+	}
+	if films, _ := repo.SearchFilm("Brat 2"); len(films) != 1 || films[0].ID != brother {
+		t.Fatalf("SearchFilm(Brat 2): expected [%d], got %v", brother, films)
+	}
+}
+
+func testRepoQuerySearch(t *testing.T, repo items.ItemRepo) {
+	hanks := mustCreateActor(t, repo, items.Actor{Name: "Tom Hanks", Gender: "male", Date: ""})
+	damon := mustCreateActor(t, repo, items.Actor{Name: "Matt Damon", Gender: "male", Date: ""})
+
+	ryan := mustCreateFilm(t, repo, items.Film{Name: "Saving Private Ryan", Description: "a squad searches for a soldier", Date: 1998, Rating: 9, Actors: []items.Actor{{ID: hanks}, {ID: damon}}})
+	castAway := mustCreateFilm(t, repo, items.Film{Name: "Cast Away", Date: 2000, Rating: 8, Actors: []items.Actor{{ID: hanks}}})
+	toyStory := mustCreateFilm(t, repo, items.Film{Name: "Toy Story 2", Date: 1999, Rating: 8, Actors: []items.Actor{{ID: hanks}}})
+	martian := mustCreateFilm(t, repo, items.Film{Name: "The Martian", Date: 2015, Actors: []items.Actor{{ID: damon}}})
+
+	cases := []struct {
+		query string
+		ids   []uint32
+	}{
+		{`actor:"Tom Hanks" year:>=1999`, []uint32{castAway, toyStory}},
+		{`actor:"tom hanks" -title:"story 2"`, []uint32{ryan, castAway}},
+		{`rating:>8 OR year:2015`, []uint32{ryan, martian}},
+		{`-rating:>=8`, []uint32{martian}},
+		{`actor:damon (year:<2000 OR title:=martian)`, []uint32{ryan}},
+		{`actor:damon (year:<2000 OR title:="the martian")`, []uint32{ryan, martian}},
+		{`soldier`, []uint32{ryan}},
+		{`description:50%`, nil},
+	}
+
+	for _, c := range cases {
+		query, err := filmql.Parse(c.query)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", c.query, err)
+		}
+
+		films, err := repo.QueryFilms(query)
+		if err != nil {
+			t.Fatalf("QueryFilms(%s): %v", c.query, err)
+		}
+
+		var got []uint32
+		for _, film := range films {
+			got = append(got, film.ID)
+		}
+		if !equalIDs(got, c.ids) {
+			t.Fatalf("QueryFilms(%s): expected %v, got %v", c.query, c.ids, got)
+		}
+	}
+}
+
+func testRepoFacets(t *testing.T, repo items.ItemRepo) {
+	hanks := mustCreateActor(t, repo, items.Actor{Name: "Tom Hanks", Gender: "male", Date: ""})
+	damon := mustCreateActor(t, repo, items.Actor{Name: "Matt Damon", Gender: "male", Date: ""})
+	sizemore := mustCreateActor(t, repo, items.Actor{Name: "Tom Sizemore", Gender: "male", Date: ""})
+
+	ryan := mustCreateFilm(t, repo, items.Film{Name: "Saving Private Ryan", Date: 1998, Rating: 9, Actors: []items.Actor{{ID: hanks}, {ID: damon}, {ID: sizemore}}})
+	castAway := mustCreateFilm(t, repo, items.Film{Name: "Cast Away", Date: 2000, Rating: 8, Actors: []items.Actor{{ID: hanks}}})
+	mustCreateFilm(t, repo, items.Film{Name: "The Martian", Date: 2015, Rating: 2, Actors: []items.Actor{{ID: damon}}})
+	mustCreateFilm(t, repo, items.Film{Name: "Untitled", Actors: []items.Actor{{ID: hanks}}})
+	deleted := mustCreateFilm(t, repo, items.Film{Name: "Sully", Date: 2016, Rating: 7, Actors: []items.Actor{{ID: hanks}}})
+	if err := repo.DeleteFilm(deleted); err != nil {
+		t.Fatalf("DeleteFilm: %v", err)
+	}
+
+	facets, err := repo.FilmFacets(items.FilmFilter{}, 2)
+	if err != nil {
+		t.Fatalf("FilmFacets: %v", err)
+	}
+	want := items.Facets{
+		Decades: []items.DecadeFacet{{Decade: 1990, Count: 1}, {Decade: 2000, Count: 1}, {Decade: 2010, Count: 1}},
+		Ratings: []items.RatingFacet{{From: 0, To: 2, Count: 1}, {From: 7, To: 8, Count: 1}, {From: 9, To: 10, Count: 1}},
+		Actors:  []items.ActorFacet{{ID: hanks, Name: "Tom Hanks", Count: 3}, {ID: damon, Name: "Matt Damon", Count: 2}},
+	}
+	if !reflect.DeepEqual(facets, want) {
+		t.Fatalf("FilmFacets: expected %+v, got %+v", want, facets)
+	}
+
+	rating := int64(8)
+	facets, err = repo.FilmFacets(items.FilmFilter{RatingFrom: &rating}, 10)
+	if err != nil {
+		t.Fatalf("FilmFacets: %v", err)
+	}
+	if len(facets.Actors) != 3 || facets.Actors[0].ID != hanks || len(facets.Decades) != 2 {
+		t.Fatalf("FilmFacets(rating_from=8): unexpected %+v", facets)
+	}
+
+	facets, err = repo.FilmFacetsByIDs([]uint32{castAway, ryan, deleted}, 10)
+	if err != nil {
+		t.Fatalf("FilmFacetsByIDs: %v", err)
+	}
+	want = items.Facets{
+		Decades: []items.DecadeFacet{{Decade: 1990, Count: 1}, {Decade: 2000, Count: 1}},
+		Ratings: []items.RatingFacet{{From: 7, To: 8, Count: 1}, {From: 9, To: 10, Count: 1}},
+		Actors:  []items.ActorFacet{{ID: hanks, Name: "Tom Hanks", Count: 2}, {ID: damon, Name: "Matt Damon", Count: 1}, {ID: sizemore, Name: "Tom Sizemore", Count: 1}},
+	}
+	if !reflect.DeepEqual(facets, want) {
+		t.Fatalf("FilmFacetsByIDs: expected %+v, got %+v", want, facets)
+	}
+
+	facets, err = repo.FilmFacetsByIDs(nil, 10)
+	if err != nil {
+		t.Fatalf("FilmFacetsByIDs: %v", err)
+	}
+	if len(facets.Decades)+len(facets.Ratings)+len(facets.Actors) != 0 || facets.Actors == nil {
+		t.Fatalf("FilmFacetsByIDs(nil): expected empty facets, got %+v", facets)
+	}
+}
+
+func testRepoActors(t *testing.T, repo items.ItemRepo) {
+	if _, err := repo.CreateActor(items.Actor{Name: "", Gender: "", Date: ""}); err == nil || err.Error() != "empty actor" {
+		t.Fatalf("expected empty actor error, got %v", err)
+	}
+
+	id := mustCreateActor(t, repo, items.Actor{Name: "Mila", Gender: "female", Date: ""})
+
+	actor, err := repo.GetActorByID(id)
+	if err != nil {
+		t.Fatalf("GetActorByID: %v", err)
+	}
+	if actor.Name != "Mila" || actor.Gender != "female" || actor.Date != nil {
+		t.Fatalf("unexpected actor %#v", actor)
+	}
+
+	if err := repo.UpdateActor(items.Actor{ID: id, Name: "Mila Kunis", Gender: "female", Date: "1983-08-14"}); err != nil {
+		t.Fatalf("UpdateActor: %v", err)
+	}
+
+	if err := repo.UpdateColumnActor(items.Actor{ID: id, Gender: "f", Date: ""}, "Gender"); err != nil {
+		t.Fatalf("UpdateColumnActor: %v", err)
+	}
+
+	actor, err = repo.GetActorByID(id)
+	if err != nil {
+		t.Fatalf("GetActorByID: %v", err)
+	}
+	date, ok := actor.Date.(time.Time)
+	if actor.Name != "Mila Kunis" || actor.Gender != "f" || !ok || date.Format("2006-01-02") != "1983-08-14" {
+		t.Fatalf("unexpected actor %#v", actor)
+	}
+
+	actors, _, err := repo.GetActors(items.Page{})
+	if err != nil {
+		t.Fatalf("GetActors: %v", err)
+	}
+	if got := actorIDs(actors); !equalIDs(got, []uint32{id}) {
+		t.Fatalf("expected actors %v, got %v", []uint32{id}, got)
+	}
+
+	if _, err := repo.GetActorByID(1000); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	if err := repo.UpdateActor(items.Actor{ID: 1000, Name: "ghost", Date: ""}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func testRepoActorSearch(t *testing.T, repo items.ItemRepo) {
+	weaver := mustCreateActor(t, repo, items.Actor{Name: "Sigourney Weaver", Gender: "female", Date: "1949-10-08"})
+	henriksen := mustCreateActor(t, repo, items.Actor{Name: "Lance Henriksen", Gender: "male", Date: "1940-05-05"})
+	reiser := mustCreateActor(t, repo, items.Actor{Name: "Paul Reiser", Gender: "male", Date: ""})
+
+	mustCreateFilm(t, repo, items.Film{Name: "Alien", Actors: []items.Actor{{ID: weaver}}})
+	mustCreateFilm(t, repo, items.Film{Name: "Aliens", Actors: []items.Actor{{ID: weaver}, {ID: henriksen}, {ID: reiser}}})
+	deleted := mustCreateFilm(t, repo, items.Film{Name: "Alien 3", Actors: []items.Actor{{ID: weaver}, {ID: henriksen}}})
+	if err := repo.DeleteFilm(deleted); err != nil {
+		t.Fatalf("DeleteFilm: %v", err)
+	}
+
+	date := func(str string) *time.Time {
+		d, _ := time.Parse("2006-01-02", str)
+		return &d
+	}
+
+	cases := []struct {
+		name   string
+		filter items.ActorFilter
+		ids    []uint32
+		counts []int
+	}{
+		{"part of name", items.ActorFilter{Name: "SEN"}, []uint32{henriksen}, []int{1}},
+		{"all names", items.ActorFilter{Name: "e"}, []uint32{henriksen, reiser, weaver}, []int{1, 1, 2}},
+		{"gender", items.ActorFilter{Name: "e", Gender: "Male"}, []uint32{henriksen, reiser}, []int{1, 1}},
+		{"born after", items.ActorFilter{Name: "e", BornFrom: date("1945-01-01")}, []uint32{weaver}, []int{2}},
+		{"born between", items.ActorFilter{Name: "e", BornFrom: date("1940-05-05"), BornTo: date("1949-10-07")}, []uint32{henriksen}, []int{1}},
+		{"wildcard is literal", items.ActorFilter{Name: "%"}, nil, nil},
+	}
+
+	for _, c := range cases {
+		actors, err := repo.SearchActors(c.filter)
+		if err != nil {
+			t.Fatalf("[%s] SearchActors: %v", c.name, err)
+		}
+
+		var ids []uint32
+		var counts []int
+		for _, actor := range actors {
+			ids = append(ids, actor.ID)
+			counts = append(counts, actor.FilmCount)
+		}
+		if !equalIDs(ids, c.ids) || !reflect.DeepEqual(counts, c.counts) {
+			t.Fatalf("[%s] expected %v with %v films, got %v with %v", c.name, c.ids, c.counts, ids, counts)
+		}
+	}
+}
+
+func testRepoSuggest(t *testing.T, repo items.ItemRepo) {
+	alien := mustCreateFilm(t, repo, items.Film{Name: "Alien"})
+	aliens := mustCreateFilm(t, repo, items.Film{Name: "Aliens"})
+	mustCreateFilm(t, repo, items.Film{Name: "Heat"})
+	deleted := mustCreateFilm(t, repo, items.Film{Name: "Alien 3"})
+	if err := repo.DeleteFilm(deleted); err != nil {
+		t.Fatalf("DeleteFilm: %v", err)
+	}
+	alicia := mustCreateActor(t, repo, items.Actor{Name: "Alicia Vikander", Date: ""})
+	weaver := mustCreateActor(t, repo, items.Actor{Name: "Sigourney Weaver", Date: ""})
+
+	suggest := func(query string, limit int) []string {
+		suggestions, err := repo.Suggest(context.Background(), query, limit)
+		if err != nil {
+			t.Fatalf("Suggest(%s): %v", query, err)
+		}
+
+		var got []string
+		for _, suggestion := range suggestions {
+			got = append(got, fmt.Sprintf("%s %d", suggestion.Type, suggestion.ID))
+		}
+		return got
+	}
+
+	got := suggest("ALI", 10)
+	sort.Strings(got)
+	want := []string{
+		fmt.Sprintf("actor %d", alicia),
+		fmt.Sprintf("film %d", alien),
+		fmt.Sprintf("film %d", aliens),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Suggest(ALI): expected %v, got %v", want, got)
+	}
+
+	if got := suggest("ali", 2); len(got) != 2 {
+		t.Fatalf("Suggest(ali, 2): expected 2 suggestions, got %v", got)
+	}
+
+	if got, want := suggest("weav", 10), []string{fmt.Sprintf("actor %d", weaver)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Suggest(weav): expected %v, got %v", want, got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := repo.Suggest(ctx, "ali", 10); err == nil {
+		t.Fatalf("Suggest: expected an error for a cancelled context")
+	}
+}
+
+func testRepoTrash(t *testing.T, repo items.ItemRepo) {
+	actorID := mustCreateActor(t, repo, items.Actor{Name: "Tom Hanks", Gender: "male", Date: ""})
+	filmID := mustCreateFilm(t, repo, items.Film{Name: "Big", Actors: []items.Actor{{ID: actorID}}})
+
+	if err := repo.DeleteActor(actorID); err != nil {
+		t.Fatalf("DeleteActor: %v", err)
+	}
+	if err := repo.DeleteActor(actorID); err == nil || err.Error() != "not found" {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if err := repo.UpdateColumnActor(items.Actor{ID: actorID, Name: "Thomas Hanks"}, "Name"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("UpdateColumnActor of a deleted actor: expected sql.ErrNoRows, got %v", err)
+	}
+	if err := repo.UpdateActor(items.Actor{ID: actorID, Name: "Thomas Hanks", Date: ""}); err == nil {
+		t.Fatalf("UpdateActor of a deleted actor: expected an error")
+	}
+	if trash, err := repo.GetTrash(); err != nil || len(trash.Actors) != 1 || trash.Actors[0].Name != "Tom Hanks" {
+		t.Fatalf("trashed actor after a refused update: got %+v, %v", trash, err)
+	}
+
+	film, err := repo.GetFilmByID(filmID)
+	if err != nil {
+		t.Fatalf("GetFilmByID: %v", err)
+	}
+	if len(film.Actors) != 0 {
+		t.Fatalf("deleted actor is still in cast: %#v", film.Actors)
+	}
+
+	if films, _ := repo.SearchFilm("hanks"); len(films) != 0 {
+		t.Fatalf("search matched deleted actor: %#v", films)
+	}
+
+	if err := repo.RestoreActor(actorID); err != nil {
+		t.Fatalf("RestoreActor: %v", err)
+	}
+	if err := repo.RestoreActor(actorID); err == nil || err.Error() != "not found" {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	if err := repo.DeleteFilm(filmID); err != nil {
+		t.Fatalf("DeleteFilm: %v", err)
+	}
+
+	if _, err := repo.GetFilmByID(filmID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+	if err := repo.UpdateColumnFilm(items.Film{ID: filmID, Rating: 9}, "Rating"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("UpdateColumnFilm of a deleted film: expected sql.ErrNoRows, got %v", err)
+	}
+	if films, _, _ := repo.GetFilms("rating", -1, items.FilmFilter{}, items.Page{}); len(films) != 0 {
+		t.Fatalf("deleted film is listed: %#v", films)
+	}
+	if films, _ := repo.GetActorFilms(items.Actor{ID: actorID}); len(films) != 0 {
+		t.Fatalf("deleted film is in filmography: %#v", films)
+	}
+
+	trash, err := repo.GetTrash()
+	if err != nil {
+		t.Fatalf("GetTrash: %v", err)
+	}
+	if len(trash.Films) != 1 || trash.Films[0].ID != filmID || len(trash.Actors) != 0 {
+		t.Fatalf("unexpected trash %#v", trash)
+	}
+
+	purged, err := repo.PurgeTrash(time.Hour)
+	if err != nil || purged != 0 {
+		t.Fatalf("PurgeTrash(1h): purged %d, err %v", purged, err)
+	}
+
+	purged, err = repo.PurgeTrash(0)
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeTrash(0): purged %d, err %v", purged, err)
+	}
+
+	if err := repo.RestoreFilm(filmID); err == nil || err.Error() != "not found" {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func testRepoConcurrentWrites(t *testing.T, repo items.ItemRepo) {
+	const writers = 10
+
+	var wg sync.WaitGroup
+	ids := make([]uint32, writers)
+	errs := make([]error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = repo.CreateFilm(items.Film{Name: fmt.Sprintf("film %d", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[uint32]struct{})
+	for i, id := range ids {
+		if errs[i] != nil {
+			t.Fatalf("CreateFilm: %v", errs[i])
+		}
+		seen[id] = struct{}{}
+	}
+	if len(seen) != writers {
+		t.Fatalf("expected %d distinct ids, got %d", writers, len(seen))
+	}
+
+	films, _, err := repo.GetFilms("name", 1, items.FilmFilter{}, items.Page{})
+	if err != nil {
+		t.Fatalf("GetFilms: %v", err)
+	}
+	if len(films) != writers {
+		t.Fatalf("expected %d films, got %d", writers, len(films))
+	}
+}
+
+func mustCreateFilm(t *testing.T, repo items.ItemRepo, film items.Film) uint32 {
+	t.Helper()
+
+	id, err := repo.CreateFilm(film)
+	if err != nil {
+		t.Fatalf("CreateFilm: %v", err)
+	}
+
+	return id
+}
+
+func mustCreateActor(t *testing.T, repo items.ItemRepo, actor items.Actor) uint32 {
+	t.Helper()
+
+	id, err := repo.CreateActor(actor)
+	if err != nil {
+		t.Fatalf("CreateActor: %v", err)
+	}
+
+	return id
+}
+
+func filmIDs(films []items.Film) []uint32 {
+	var ids []uint32
+	for _, film := range films {
+		ids = append(ids, film.ID)
+	}
+
+	return ids
+}
+
+func actorIDs(actors []items.Actor) []uint32 {
+	var ids []uint32
+	for _, actor := range actors {
+		ids = append(ids, actor.ID)
+	}
+
+	return ids
+}
+
+func sortedIDs(ids []uint32) []uint32 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func equalIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func toInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	default:
+		return -1
+	}
+}
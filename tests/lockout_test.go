@@ -0,0 +1,247 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"filmlibrary/pkg/config"
+	"filmlibrary/pkg/explorer"
+	"filmlibrary/pkg/items"
+	"filmlibrary/pkg/lockout"
+	"filmlibrary/pkg/users"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func testGuardConfig() config.Lockout {
+	return config.Lockout{
+		FreeFailures:   1,
+		MaxFailures:    4,
+		FreeFailuresIP: 5,
+		MaxFailuresIP:  6,
+		Backoff:        time.Second,
+		MaxBackoff:     3 * time.Second,
+		Duration:       time.Minute,
+		Window:         time.Hour,
+	}
+}
+
+func TestGuardBackoffAndLockout(t *testing.T) {
+	repo := users.NewMapRepo()
+	guard := lockout.NewGuard(repo, testGuardConfig(), zap.NewNop().Sugar())
+
+	now := time.Now()
+	begin := func(username, ip string) time.Duration {
+		t.Helper()
+
+		wait, err := guard.Begin(username, ip, now)
+		if err != nil {
+			t.Fatalf("Begin: %v", err)
+		}
+		return wait
+	}
+
+	// attempts quiet for the whole window are pruned
+	err := repo.UpdateLogins([]string{"ip:203.0.113.9"}, func(attempts []*users.LoginAttempt) {
+		attempts[0].Failures, attempts[0].LastFailure = 3, now.Add(-2*time.Hour)
+	})
+	if err != nil {
+		t.Fatalf("UpdateLogins: %v", err)
+	}
+
+	if got := begin("Admin", "192.0.2.1"); got != 0 {
+		t.Fatalf("free failure: expected no wait, got %v", got)
+	}
+	if attempt, _ := repo.LoginAttempt("ip:203.0.113.9"); attempt.Failures != 0 {
+		t.Fatalf("stale attempt: expected it pruned, got %+v", attempt)
+	}
+
+	// past the free failure the wait doubles up to MaxBackoff
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second} {
+		if got := begin("admin", "192.0.2.1"); got != 0 {
+			t.Fatalf("attempt starting a backoff: expected no wait, got %v", got)
+		}
+		if got := begin("ADMIN", "192.0.2.1"); got != expected {
+			t.Fatalf("backoff: expected %v, got %v", expected, got)
+		}
+		now = now.Add(expected)
+	}
+
+	begin("admin", "192.0.2.1")
+	if got := begin("admin", "198.51.100.7"); got != time.Minute {
+		t.Fatalf("lockout: expected %v from any IP, got %v", time.Minute, got)
+	}
+	if got := begin("someone", "198.51.100.7"); got != 0 {
+		t.Fatalf("other user from another IP: expected no wait, got %v", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := begin("admin", "198.51.100.7"); got != 0 {
+		t.Fatalf("after the lockout: expected no wait, got %v", got)
+	}
+	if attempt, _ := repo.LoginAttempt("user:admin"); attempt.Failures != 1 || attempt.Locked {
+		t.Fatalf("after the lockout: expected the count to start over, got %+v", attempt)
+	}
+	if err := guard.Succeeded("admin", "198.51.100.7"); err != nil {
+		t.Fatalf("Succeeded: %v", err)
+	}
+	if attempt, _ := repo.LoginAttempt("user:admin"); attempt.Failures != 0 {
+		t.Fatalf("after a success: expected no failures of the user, got %+v", attempt)
+	}
+	if attempt, _ := repo.LoginAttempt("ip:198.51.100.7"); attempt.Failures != 1 {
+		t.Fatalf("after a success: expected the other failure of the IP to stay, got %+v", attempt)
+	}
+
+	// a login ending before the password check is given back
+	begin("someone", "203.0.113.9")
+	if err := guard.Release("someone", "203.0.113.9"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if attempt, _ := repo.LoginAttempt("ip:203.0.113.9"); attempt.Failures != 0 {
+		t.Fatalf("after Release: expected no failures, got %+v", attempt)
+	}
+
+	// guessing many usernames from one IP locks the IP
+	for i := 0; i < 2; i++ {
+		begin(fmt.Sprintf("user%d", i), "192.0.2.1")
+	}
+	if got := begin("fresh", "192.0.2.1"); got != time.Minute {
+		t.Fatalf("IP lockout: expected %v, got %v", time.Minute, got)
+	}
+
+	if err := guard.Unlock("user0"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if got := begin("user0", "198.51.100.7"); got != 0 {
+		t.Fatalf("after unlock: expected no wait, got %v", got)
+	}
+}
+
+func TestGuardParallelLogins(t *testing.T) {
+	guard := lockout.NewGuard(users.NewMapRepo(), testGuardConfig(), zap.NewNop().Sugar())
+
+	now := time.Now()
+	var wg sync.WaitGroup
+	var passed int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			wait, err := guard.Begin("admin", "192.0.2.1", now)
+			if err != nil {
+				t.Errorf("Begin: %v", err)
+				return
+			}
+			if wait == 0 {
+				atomic.AddInt32(&passed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the free failure and the one starting the backoff
+	if passed != 2 {
+		t.Fatalf("parallel guesses: expected 2 through, got %d", passed)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	useTestKeys(t)
+	t.Setenv("LOGIN_FREE_FAILURES", "0")
+	t.Setenv("LOGIN_MAX_FAILURES", "2")
+	t.Setenv("LOGIN_BACKOFF", "30s")
+
+	userRepo := sessionUsers(t)
+	victim, err := userRepo.Signup("victim", "MySuperSecretPassword")
+	if err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+
+	handler, err := explorer.NewRepoExplorer(items.NewMapRepo(), userRepo, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewRepoExplorer: %v", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	login := func(username, password string) *http.Response {
+		t.Helper()
+
+		data, _ := json.Marshal(CR{"username": username, "password": password})
+		resp, err := client.Post(ts.URL+"/api/login", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := login("victim", "guess"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong password: expected 401, got %d", resp.StatusCode)
+	}
+
+	resp := login("victim", "MySuperSecretPassword")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "30" {
+		t.Fatalf("during backoff: expected 429 with Retry-After 30, got %d, %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// serve the backoff; the next failure reaches the lockout
+	serve := func(attempts []*users.LoginAttempt) { attempts[0].BlockedUntil = time.Time{} }
+	if err := userRepo.UpdateLogins([]string{"user:victim"}, serve); err != nil {
+		t.Fatalf("UpdateLogins: %v", err)
+	}
+	if resp := login("victim", "guess"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong password after the backoff: expected 401, got %d", resp.StatusCode)
+	}
+
+	resp = login("victim", "MySuperSecretPassword")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "900" {
+		t.Fatalf("locked out: expected 429 with Retry-After 900, got %d, %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	admin := login("admin", "MySuperSecretPassword").Header.Get("Authorization")
+	unlock := fmt.Sprintf("/api/users/%d/unlock", victim.ID)
+	if status := apiCall(t, ts, http.MethodPost, unlock, admin, nil, nil); status != http.StatusOK {
+		t.Fatalf("unlock: expected 200, got %d", status)
+	}
+	if resp := login("victim", "MySuperSecretPassword"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login after unlock: expected 200, got %d", resp.StatusCode)
+	}
+	if status := apiCall(t, ts, http.MethodPost, "/api/users/1000/unlock", admin, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("unlock a missing user: expected 404, got %d", status)
+	}
+
+	// guessing the current password with a token is throttled the same
+	token := login("victim", "MySuperSecretPassword").Header.Get("Authorization")
+	change := CR{"old_password": "guess", "new_password": "AnotherSecretPassword"}
+	if status := apiCall(t, ts, http.MethodPost, "/api/me/password", token, change, nil); status != http.StatusForbidden {
+		t.Fatalf("wrong old password: expected 403, got %d", status)
+	}
+	change["old_password"] = "MySuperSecretPassword"
+	if status := apiCall(t, ts, http.MethodPost, "/api/me/password", token, change, nil); status != http.StatusTooManyRequests {
+		t.Fatalf("password change during backoff: expected 429, got %d", status)
+	}
+
+	// a deleted account takes its failures along, the next owner of the
+	// name starts clean
+	if status := apiCall(t, ts, http.MethodDelete, fmt.Sprintf("/api/users/%d", victim.ID), admin, nil, nil); status != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", status)
+	}
+	if attempt, _ := userRepo.LoginAttempt("user:victim"); attempt.Failures != 0 || !attempt.BlockedUntil.IsZero() {
+		t.Fatalf("failures of a deleted account: expected none, got %+v", attempt)
+	}
+	if _, err := userRepo.Signup("victim", "MySuperSecretPassword"); err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+	if resp := login("victim", "MySuperSecretPassword"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login of the new victim: expected 200, got %d", resp.StatusCode)
+	}
+}
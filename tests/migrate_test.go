@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"filmlibrary/migrations"
+	"filmlibrary/pkg/migrate"
+	"fmt"
+	"testing"
+	"testing/fstest"
+)
+
+// PrepareSchema drops everything in the public schema, tables as well as
+// the functions of the search migrations, and recreates the schema from
+// the embedded migrations.
+func PrepareSchema(db *sql.DB) {
+	qs := []string{
+		`DROP SCHEMA public CASCADE;`,
+		`CREATE SCHEMA public;`,
+	}
+
+	for _, q := range qs {
+		_, err := db.Exec(q)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := migrator.Up(); err != nil {
+		panic(err)
+	}
+}
+
+func TestMigrationsLoad(t *testing.T) {
+	migrator, err := migrate.New(nil, migrations.FS)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	for i, m := range migrator.Migrations {
+		if m.Version != uint(i+1) {
+			t.Fatalf("expected version %d, got %d", i+1, m.Version)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Fatalf("migration %d has no up or down script", m.Version)
+		}
+	}
+
+	if migrator.Latest() != uint(len(migrator.Migrations)) {
+		t.Fatalf("expected latest %d, got %d", len(migrator.Migrations), migrator.Latest())
+	}
+
+	_, err = migrate.New(nil, fstest.MapFS{
+		"000001_init.up.sql": {Data: []byte("SELECT 1;")},
+	})
+	if err == nil {
+		t.Fatalf("expected error for a migration without down script")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	DSN := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable",
+		user, password, host, dbname)
+
+	db, err := sql.Open("postgres", DSN)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		t.Skipf("postgres is not available: %v", err)
+	}
+
+	PrepareSchema(db)
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if err := migrator.CheckCurrent(); err != nil {
+		t.Fatalf("CheckCurrent: %v", err)
+	}
+
+	if err := migrator.Down(); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+
+	if current, _ := migrator.Current(); current != migrator.Latest()-1 {
+		t.Fatalf("expected version %d after down, got %d", migrator.Latest()-1, current)
+	}
+
+	if err := migrator.CheckCurrent(); !errors.Is(err, migrate.ErrSchemaBehind) {
+		t.Fatalf("expected ErrSchemaBehind, got %v", err)
+	}
+
+	if err := migrator.Goto(0); err != nil {
+		t.Fatalf("Goto(0): %v", err)
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass('films') IS NOT NULL").Scan(&exists); err != nil || exists {
+		t.Fatalf("films table survived Goto(0): %v", err)
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			t.Fatalf("migration %d is still applied", status.Version)
+		}
+	}
+
+	if err := migrator.Goto(1000); err == nil {
+		t.Fatalf("expected error for unknown version")
+	}
+
+	// a database created by the old initdb script holds the version 1 schema
+	if _, err := db.Exec(migrator.Migrations[0].Up); err != nil {
+		t.Fatalf("init script: %v", err)
+	}
+	if err := migrator.Up(); err == nil {
+		t.Fatalf("expected Up to fail on an unversioned schema")
+	}
+	if err := migrator.Baseline(1); err != nil {
+		t.Fatalf("Baseline: %v", err)
+	}
+	if current, _ := migrator.Current(); current != 1 {
+		t.Fatalf("expected version 1 after Baseline, got %d", current)
+	}
+	if err := migrator.Baseline(1); err == nil {
+		t.Fatalf("expected Baseline to refuse a versioned schema")
+	}
+
+	if err := migrator.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"database/sql"
+	"filmlibrary/pkg/items"
+	"fmt"
+	"testing"
+)
+
+// seedCatalog creates size actors and size films, every actor plays in two films.
+func seedCatalog(tb testing.TB, db *sql.DB, size int) {
+	tb.Helper()
+
+	PrepareFilms(db)
+
+	qs := []string{
+		`INSERT INTO actors (name) SELECT 'actor ' || g FROM generate_series(1, $1) AS g`,
+		`INSERT INTO films (name) SELECT 'film ' || g FROM generate_series(1, $1) AS g`,
+		`INSERT INTO film_actor (film_id, actor_id)
+			SELECT id, id FROM actors
+			UNION SELECT (id % $1) + 1, id FROM actors`,
+	}
+
+	for _, q := range qs {
+		if _, err := db.Exec(q, size); err != nil {
+			tb.Fatalf("seed: %v", err)
+		}
+	}
+}
+
+func TestGetActorsQueryCount(t *testing.T) {
+	db := openInstrumentedDB(t)
+	defer db.Close()
+
+	repo := items.NewMemoryRepo(db)
+
+	var counts []int64
+	for _, size := range []int{5, 50} {
+		seedCatalog(t, db, size)
+
+		count := countQueries(t, func() {
+			actors, _, err := repo.GetActors(items.Page{})
+			if err != nil {
+				t.Fatalf("GetActors: %v", err)
+			}
+			if len(actors) != size {
+				t.Fatalf("expected %d actors, got %d", size, len(actors))
+			}
+			for _, actor := range actors {
+				if films, _ := actor.Films.([]items.Film); len(films) != 2 {
+					t.Fatalf("expected 2 films for actor %d, got %v", actor.ID, actor.Films)
+				}
+			}
+		})
+		counts = append(counts, count)
+	}
+
+	if counts[0] != counts[1] {
+		t.Fatalf("query count grows with the number of actors: %v", counts)
+	}
+
+	count := countQueries(t, func() {
+		film, err := repo.GetFilmByID(1)
+		if err != nil {
+			t.Fatalf("GetFilmByID: %v", err)
+		}
+		if len(film.Actors) != 2 {
+			t.Fatalf("expected 2 actors, got %v", film.Actors)
+		}
+	})
+	if count != 1 {
+		t.Fatalf("GetFilmByID: expected 1 query, got %d", count)
+	}
+}
+
+func BenchmarkGetActorsQueries(b *testing.B) {
+	db := openInstrumentedDB(b)
+	defer db.Close()
+
+	repo := items.NewMemoryRepo(db)
+
+	for _, size := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("actors=%d", size), func(b *testing.B) {
+			seedCatalog(b, db, size)
+			b.ResetTimer()
+
+			queries := countQueries(b, func() {
+				for i := 0; i < b.N; i++ {
+					if _, _, err := repo.GetActors(items.Page{}); err != nil {
+						b.Fatalf("GetActors: %v", err)
+					}
+				}
+			})
+
+			b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"filmlibrary/pkg/access"
+	"filmlibrary/pkg/config"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/explorer"
+	"filmlibrary/pkg/handlers"
+	"filmlibrary/pkg/items"
+	"filmlibrary/pkg/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter, err := ratelimit.NewLimiter(config.RateLimit{
+		Requests: 3,
+		Period:   3 * time.Second,
+		Roles:    map[string]int{"admin": 6},
+		Routes:   map[string]int{"/api/films/search": 1},
+	})
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
+	}
+
+	now := time.Now()
+	for remaining := 2; remaining >= 0; remaining-- {
+		result := limiter.Allow("ip:192.0.2.1", access.Guest, "/api/films", now)
+		if !result.Allowed || result.Limit != 3 || result.Remaining != remaining {
+			t.Fatalf("burst: expected %d remaining, got %+v", remaining, result)
+		}
+	}
+
+	result := limiter.Allow("ip:192.0.2.1", access.Guest, "/api/films", now)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Fatalf("empty bucket: expected a retry after 1s, got %+v", result)
+	}
+	if result := limiter.Allow("ip:198.51.100.7", access.Guest, "/api/films", now); !result.Allowed {
+		t.Fatalf("another client: expected its own bucket, got %+v", result)
+	}
+
+	now = now.Add(time.Second)
+	if result := limiter.Allow("ip:192.0.2.1", access.Guest, "/api/films", now); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("after a refill: expected one request, got %+v", result)
+	}
+
+	// a limited route takes from its own bucket and the client's
+	result = limiter.Allow("user:1", access.Admin, "/api/films/search", now)
+	if !result.Allowed || result.Limit != 1 || result.Remaining != 0 {
+		t.Fatalf("limited route: expected its limit, got %+v", result)
+	}
+	if result := limiter.Allow("user:1", access.Admin, "/api/films/search", now); result.Allowed {
+		t.Fatalf("limited route: expected 429, got %+v", result)
+	}
+	result = limiter.Allow("user:1", access.Admin, "/api/films", now)
+	if !result.Allowed || result.Limit != 6 || result.Remaining != 4 {
+		t.Fatalf("role limit: expected 4 of 6 left, got %+v", result)
+	}
+
+	if _, err := ratelimit.NewLimiter(config.RateLimit{Requests: 1, Period: time.Second, Roles: map[string]int{"owner": 1}}); err == nil {
+		t.Fatalf("NewLimiter: expected an error for an unknown role")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	useTestKeys(t)
+	t.Setenv("RATE_LIMIT_REQUESTS", "4")
+	t.Setenv("RATE_LIMIT_ROLES", "admin:10")
+	t.Setenv("RATE_LIMIT_ROUTES", "/api/films/search:1")
+
+	handler, err := explorer.NewRepoExplorer(items.NewMapRepo(), sessionUsers(t), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewRepoExplorer: %v", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	get := func(path, auth string) *http.Response {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		req.Header.Set("Authorization", auth)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		return resp
+	}
+
+	resp := get("/api/films/search?q=matrix", "")
+	resp.Body.Close()
+	if resp.Header.Get("RateLimit-Limit") != "1" || resp.Header.Get("RateLimit-Remaining") != "0" || resp.Header.Get("RateLimit-Policy") != "1;w=60" {
+		t.Fatalf("search: unexpected headers %v", resp.Header)
+	}
+
+	resp = get("/api/films/search?q=matrix", "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "60" {
+		t.Fatalf("second search: expected 429 with Retry-After 60, got %d, %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	var body handlers.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error != errs.TooManyRequests {
+		t.Fatalf("429 body: got %+v, %v", body, err)
+	}
+
+	resp = get("/api/films", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Limit") != "4" || resp.Header.Get("RateLimit-Remaining") != "2" {
+		t.Fatalf("films: expected 200 with 2 of 4 left, the 429 taking none, got %d, %v", resp.StatusCode, resp.Header)
+	}
+
+	data, _ := json.Marshal(CR{"username": "admin", "password": "MySuperSecretPassword"})
+	resp, err = client.Post(ts.URL+"/api/login", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", resp.StatusCode)
+	}
+	admin := resp.Header.Get("Authorization")
+
+	resp = get("/api/films", admin)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Limit") != "10" || resp.Header.Get("RateLimit-Remaining") != "9" {
+		t.Fatalf("films as admin: expected 200 with 9 of 10 left, got %d, %v", resp.StatusCode, resp.Header)
+	}
+
+	// unmatched paths and methods draw from the client's bucket too, the
+	// login having taken the third request of the IP
+	resp = get("/api/nothing", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || resp.Header.Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("unknown path: expected 404 with 0 of 4 left, got %d, %v", resp.StatusCode, resp.Header)
+	}
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/films", nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /api/films: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unknown method with an empty bucket: expected 429, got %d", resp.StatusCode)
+	}
+}
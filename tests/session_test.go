@@ -0,0 +1,492 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"filmlibrary/pkg/config"
+	"filmlibrary/pkg/explorer"
+	"filmlibrary/pkg/items"
+	"filmlibrary/pkg/session"
+	"filmlibrary/pkg/users"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const testSecret = "test-secret-that-is-32-bytes-long"
+
+// useTestKeys configures the HS256 key the explorer signs tokens with.
+func useTestKeys(t *testing.T) {
+	t.Helper()
+	t.Setenv("JWT_SECRET", testSecret)
+}
+
+func mustHMACKey(t *testing.T, kid, secret string) *session.Key {
+	t.Helper()
+
+	key, err := session.NewHMACKey(kid, []byte(secret))
+	if err != nil {
+		t.Fatalf("NewHMACKey: %v", err)
+	}
+	return key
+}
+
+func mustKeys(t *testing.T, primary string, keys ...*session.Key) *session.Keys {
+	t.Helper()
+
+	set, err := session.NewKeys(primary, time.Hour, 24*time.Hour, keys...)
+	if err != nil {
+		t.Fatalf("NewKeys: %v", err)
+	}
+	return set
+}
+
+// issueToken signs a token for login with keys and returns the Authorization header.
+func issueToken(t *testing.T, keys *session.Keys, repo users.UserRepo, login string) string {
+	t.Helper()
+
+	user, err := repo.GetUserByUsername(login)
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	if err := keys.CreateToken(w, r, &user, repo); err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	return w.Header().Get("Authorization")
+}
+
+func sessionUsers(t *testing.T) users.UserRepo {
+	t.Helper()
+
+	repo := users.NewMapRepo()
+	if _, err := repo.AddUser("admin", "MySuperSecretPassword", "admin"); err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	return repo
+}
+
+func TestKeysRotation(t *testing.T) {
+	repo := sessionUsers(t)
+	old := mustHMACKey(t, "2024a", strings.Repeat("a", 32))
+	current := mustHMACKey(t, "2024b", strings.Repeat("b", 32))
+
+	oldToken := issueToken(t, mustKeys(t, "", old), repo, "admin")
+
+	rotated := mustKeys(t, "2024b", old, current)
+	user, err := rotated.GetUser(oldToken, repo)
+	if err != nil || user.Login != "admin" || user.Role != "admin" {
+		t.Fatalf("token of a still accepted key: got %+v, %v", user, err)
+	}
+
+	newToken := issueToken(t, rotated, repo, "admin")
+	claims := jwt.MapClaims{}
+	parsed, _, err := jwt.NewParser().ParseUnverified(strings.TrimPrefix(newToken, "Bearer "), claims)
+	if err != nil || parsed.Header["kid"] != "2024b" {
+		t.Fatalf("expected new tokens signed by 2024b, got %v, %v", parsed.Header, err)
+	}
+
+	retired := mustKeys(t, "", current)
+	if _, err := retired.GetUser(oldToken, repo); err == nil {
+		t.Fatalf("token of a retired key accepted")
+	}
+	if _, err := retired.GetUser(newToken, repo); err != nil {
+		t.Fatalf("token of the primary key rejected: %v", err)
+	}
+}
+
+func TestKeysAsymmetric(t *testing.T) {
+	repo := sessionUsers(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	cases := []struct {
+		alg     string
+		private interface{}
+		public  interface{}
+	}{
+		{"RS256", rsaKey, &rsaKey.PublicKey},
+		{"EdDSA", edKey, edKey.Public()},
+	}
+
+	for _, c := range cases {
+		signer, err := session.ParseKey("sign", c.alg, privatePEM(t, c.private))
+		if err != nil {
+			t.Fatalf("[%s] ParseKey private: %v", c.alg, err)
+		}
+		verifier, err := session.ParseKey("sign", c.alg, publicPEM(t, c.public))
+		if err != nil {
+			t.Fatalf("[%s] ParseKey public: %v", c.alg, err)
+		}
+		if verifier.CanSign() {
+			t.Fatalf("[%s] public key can sign", c.alg)
+		}
+
+		token := issueToken(t, mustKeys(t, "", signer), repo, "admin")
+		if _, err := mustKeys(t, "", signer).GetUser(token, repo); err != nil {
+			t.Fatalf("[%s] GetUser: %v", c.alg, err)
+		}
+
+		if _, err := session.NewKeys("", time.Hour, time.Hour, verifier); err == nil {
+			t.Fatalf("[%s] public key accepted as primary", c.alg)
+		}
+
+		// a verifying service holds the public key only
+		verifying := mustKeys(t, "hs", mustHMACKey(t, "hs", testSecret), verifier)
+		if _, err := verifying.GetUser(token, repo); err != nil {
+			t.Fatalf("[%s] GetUser with the public key: %v", c.alg, err)
+		}
+
+		// an HS256 token keyed by the public key must not pass as the asymmetric key
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user": map[string]string{"username": "admin"}})
+		forged.Header["kid"] = "sign"
+		forgedStr, err := forged.SignedString(publicPEM(t, c.public))
+		if err != nil {
+			t.Fatalf("[%s] SignedString: %v", c.alg, err)
+		}
+		if _, err := verifying.GetUser("Bearer "+forgedStr, repo); err == nil {
+			t.Fatalf("[%s] HS256 token signed with the public key accepted", c.alg)
+		}
+	}
+}
+
+func TestKeysRejectBadTokens(t *testing.T) {
+	repo := sessionUsers(t)
+	keys := mustKeys(t, "", mustHMACKey(t, "k1", testSecret))
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"user": map[string]string{"username": "admin"}})
+	unsigned.Header["kid"] = "k1"
+	noneStr, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	// the secret that used to be hard-coded
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user": map[string]string{"username": "admin"}})
+	legacyStr, err := legacy.SignedString([]byte("secretKey"))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	for _, token := range []string{noneStr, legacyStr, "garbage"} {
+		if _, err := keys.GetUser("Bearer "+token, repo); err == nil {
+			t.Fatalf("token %s accepted", token)
+		}
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	if _, err := session.LoadKeys(config.JWT{TTL: time.Hour}); err == nil {
+		t.Fatalf("expected an error without keys")
+	}
+	if _, err := session.LoadKeys(config.JWT{Secret: "short", SecretKID: "default"}); err == nil {
+		t.Fatalf("expected an error for a short secret")
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "old.key")
+	if err := os.WriteFile(file, []byte(strings.Repeat("o", 40)+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfg := config.JWT{
+		Keys:       []string{"old:HS256:" + file},
+		PrimaryKID: "new",
+		Secret:     testSecret,
+		SecretKID:  "new",
+		TTL:        time.Hour,
+	}
+	keys, err := session.LoadKeys(cfg)
+	if err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+
+	repo := sessionUsers(t)
+	oldKeys := mustKeys(t, "", mustHMACKey(t, "old", strings.Repeat("o", 40)))
+	if _, err := keys.GetUser(issueToken(t, oldKeys, repo, "admin"), repo); err != nil {
+		t.Fatalf("token of the file key rejected: %v", err)
+	}
+
+	for _, bad := range []config.JWT{
+		{Keys: []string{"old:HS256"}},
+		{Keys: []string{"old:PS512:" + file}},
+		{Keys: []string{"old:HS256:" + filepath.Join(dir, "missing")}},
+		{Keys: []string{"old:HS256:" + file}, PrimaryKID: "other"},
+	} {
+		if _, err := session.LoadKeys(bad); err == nil {
+			t.Fatalf("LoadKeys(%+v): expected an error", bad)
+		}
+	}
+}
+
+func privatePEM(t *testing.T, key interface{}) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicPEM(t *testing.T, key interface{}) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	useTestKeys(t)
+
+	userRepo := sessionUsers(t)
+	handler, err := explorer.NewRepoExplorer(items.NewMapRepo(), userRepo, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewRepoExplorer: %v", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	post := func(path, auth string, body interface{}) *http.Response {
+		t.Helper()
+
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set("Authorization", auth)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	films := func(auth string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/films", nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set("Authorization", auth)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET /api/films: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	login := post("/api/login", "", CR{"username": "admin", "password": "MySuperSecretPassword"})
+	access, refresh := login.Header.Get("Authorization"), login.Header.Get(session.RefreshHeader)
+	if login.StatusCode != http.StatusOK || access == "" || refresh == "" {
+		t.Fatalf("login: status %d, access %q, refresh %q", login.StatusCode, access, refresh)
+	}
+
+	refreshed := post("/api/token/refresh", "", CR{"refresh_token": refresh})
+	newAccess, newRefresh := refreshed.Header.Get("Authorization"), refreshed.Header.Get(session.RefreshHeader)
+	if refreshed.StatusCode != http.StatusOK || newAccess == "" || newRefresh == "" || newRefresh == refresh {
+		t.Fatalf("refresh: status %d, access %q, refresh %q", refreshed.StatusCode, newAccess, newRefresh)
+	}
+	if status := films(newAccess); status != http.StatusOK {
+		t.Fatalf("refreshed access token: status %d", status)
+	}
+
+	// the spent refresh token shows up again: the whole family goes
+	if resp := post("/api/token/refresh", "", CR{"refresh_token": refresh}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: expected 401, got %d", resp.StatusCode)
+	}
+	if status := films(newAccess); status != http.StatusForbidden {
+		t.Fatalf("access token of a revoked family: expected 403, got %d", status)
+	}
+	if resp := post("/api/token/refresh", "", CR{"refresh_token": newRefresh}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("refresh token of a revoked family: expected 401, got %d", resp.StatusCode)
+	}
+
+	login = post("/api/login", "", CR{"username": "admin", "password": "MySuperSecretPassword"})
+	access, refresh = login.Header.Get("Authorization"), login.Header.Get(session.RefreshHeader)
+	other := post("/api/login", "", CR{"username": "admin", "password": "MySuperSecretPassword"}).Header.Get("Authorization")
+
+	if resp := post("/api/logout", access, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("logout: expected 200, got %d", resp.StatusCode)
+	}
+	if status := films(access); status != http.StatusForbidden {
+		t.Fatalf("access token after logout: expected 403, got %d", status)
+	}
+	if resp := post("/api/token/refresh", "", CR{"refresh_token": refresh}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("refresh token after logout: expected 401, got %d", resp.StatusCode)
+	}
+	if status := films(other); status != http.StatusOK {
+		t.Fatalf("another login after logout: expected 200, got %d", status)
+	}
+
+	if resp := post("/api/logout", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("logout without a token: expected 401, got %d", resp.StatusCode)
+	}
+	if resp := post("/api/token/refresh", "", CR{"refresh_token": "made-up"}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unknown refresh token: expected 401, got %d", resp.StatusCode)
+	}
+}
+
+func TestSessionsEndpoints(t *testing.T) {
+	useTestKeys(t)
+
+	userRepo := sessionUsers(t)
+	handler, err := explorer.NewRepoExplorer(items.NewMapRepo(), userRepo, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewRepoExplorer: %v", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	do := func(method, path, auth, userAgent string, body, data interface{}) *http.Response {
+		t.Helper()
+
+		var reader io.Reader
+		if body != nil {
+			encoded, err := json.Marshal(body)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			reader = bytes.NewReader(encoded)
+		}
+		req, err := http.NewRequest(method, ts.URL+path, reader)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set("Authorization", auth)
+		req.Header.Set("User-Agent", userAgent)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+
+		if data != nil && resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&struct{ Data interface{} }{data}); err != nil {
+				t.Fatalf("%s %s: decode: %v", method, path, err)
+			}
+		}
+		return resp
+	}
+	login := func(username, userAgent string) string {
+		t.Helper()
+
+		resp := do(http.MethodPost, "/api/login", "", userAgent, CR{"username": username, "password": "MySuperSecretPassword"}, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("login %s: status %d", username, resp.StatusCode)
+		}
+		return resp.Header.Get("Authorization")
+	}
+
+	laptop := login("admin", "laptop-browser")
+	phone := login("admin", "phone-app")
+
+	var sessions []users.Session
+	if resp := do(http.MethodGet, "/api/me/sessions", laptop, "laptop-browser", nil, &sessions); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/me/sessions: status %d", resp.StatusCode)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("GET /api/me/sessions: expected 2 sessions, got %+v", sessions)
+	}
+	var phoneID string
+	for _, s := range sessions {
+		if s.IP == "" {
+			t.Fatalf("session %s: expected the client IP", s.ID)
+		}
+		switch s.UserAgent {
+		case "laptop-browser":
+			if !s.Current {
+				t.Fatalf("laptop session: expected current")
+			}
+		case "phone-app":
+			if s.Current {
+				t.Fatalf("phone session: expected not current")
+			}
+			phoneID = s.ID
+		default:
+			t.Fatalf("unexpected user agent %q", s.UserAgent)
+		}
+	}
+
+	if resp := do(http.MethodDelete, "/api/me/sessions/"+phoneID, laptop, "", nil, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE my session: expected 200, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/api/films", phone, "", nil, nil); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("access token of a revoked session: expected 403, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodDelete, "/api/me/sessions/"+phoneID, laptop, "", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("DELETE a revoked session: expected 404, got %d", resp.StatusCode)
+	}
+
+	register := do(http.MethodPost, "/api/register", "", "", CR{"username": "viewer", "password": "MySuperSecretPassword"}, nil)
+	if register.StatusCode != http.StatusCreated {
+		t.Fatalf("register: status %d", register.StatusCode)
+	}
+	viewer := register.Header.Get("Authorization")
+
+	do(http.MethodGet, "/api/me/sessions", laptop, "", nil, &sessions)
+	laptopID := sessions[0].ID
+	if resp := do(http.MethodDelete, "/api/me/sessions/"+laptopID, viewer, "", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("DELETE a session of another user: expected 404, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/api/me/sessions", "", "", nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("GET /api/me/sessions signed out: expected 401, got %d", resp.StatusCode)
+	}
+
+	viewerUser, err := userRepo.GetUserByUsername("viewer")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	path := fmt.Sprintf("/api/users/%d/sessions", viewerUser.ID)
+
+	if resp := do(http.MethodDelete, path, viewer, "", nil, nil); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("DELETE user sessions as a user: expected 403, got %d", resp.StatusCode)
+	}
+	var revoked int
+	if resp := do(http.MethodDelete, path, laptop, "", nil, &revoked); resp.StatusCode != http.StatusOK || revoked != 1 {
+		t.Fatalf("DELETE user sessions as admin: status %d, revoked %d", resp.StatusCode, revoked)
+	}
+	if resp := do(http.MethodGet, "/api/films", viewer, "", nil, nil); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("access token after the admin revoked: expected 403, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodDelete, "/api/users/1000/sessions", laptop, "", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("DELETE sessions of a missing user: expected 404, got %d", resp.StatusCode)
+	}
+}
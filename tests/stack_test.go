@@ -0,0 +1,489 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"filmlibrary/pkg/explorer"
+	"filmlibrary/pkg/items"
+	"filmlibrary/pkg/users"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// StackCase is one request against the full HTTP stack. Login stores the
+// returned token under a name, Token sends the token stored under that name.
+type StackCase struct {
+	Name   string
+	Method string
+	Path   string
+	Token  string
+	Body   interface{}
+	Status int
+	Result interface{}
+	Login  string
+}
+
+func TestMapStack(t *testing.T) {
+	useTestKeys(t)
+
+	logger := zap.NewNop().Sugar()
+
+	userRepo := users.NewMapRepo()
+	if _, err := userRepo.AddUser("admin", "MySuperSecretPassword", "admin"); err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+
+	handler, err := explorer.NewRepoExplorer(items.NewMapRepo(), userRepo, logger)
+	if err != nil {
+		t.Fatalf("NewRepoExplorer: %v", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	cases := []StackCase{
+		{
+			Name:   "register",
+			Method: http.MethodPost,
+			Path:   "/api/register",
+			Body:   CR{"username": "hello", "password": "privetMir"},
+			Status: http.StatusCreated,
+			Result: CR{"data": 2},
+			Login:  "hello",
+		},
+		{
+			Name:   "duplicate register",
+			Method: http.MethodPost,
+			Path:   "/api/register",
+			Body:   CR{"username": "hello", "password": "privetMir"},
+			Status: http.StatusConflict,
+			Result: CR{"error": "user already exists"},
+		},
+		{
+			Name:   "register differs in case only",
+			Method: http.MethodPost,
+			Path:   "/api/register",
+			Body:   CR{"username": "HELLO", "password": "privetMir"},
+			Status: http.StatusConflict,
+			Result: CR{"error": "user already exists"},
+		},
+		{
+			Name:   "bad password",
+			Method: http.MethodPost,
+			Path:   "/api/login",
+			Body:   CR{"username": "hello", "password": "wrongPassword"},
+			Status: http.StatusUnauthorized,
+			Result: CR{"error": "invalid password"},
+		},
+		{
+			Name:   "admin login",
+			Method: http.MethodPost,
+			Path:   "/api/login",
+			Body:   CR{"username": "admin", "password": "MySuperSecretPassword"},
+			Status: http.StatusOK,
+			Result: CR{"data": 1},
+			Login:  "admin",
+		},
+		{
+			Name:   "user cannot create film",
+			Method: http.MethodPost,
+			Path:   "/api/films",
+			Token:  "hello",
+			Body:   CR{"name": "Alien", "date": 1979, "rating": 8},
+			Status: http.StatusForbidden,
+		},
+		{
+			Name:   "admin creates film",
+			Method: http.MethodPost,
+			Path:   "/api/films",
+			Token:  "admin",
+			Body:   CR{"name": "Alien", "date": 1979, "rating": 8},
+			Status: http.StatusCreated,
+			Result: CR{"data": 1},
+		},
+		{
+			Name:   "unknown actor in cast",
+			Method: http.MethodPost,
+			Path:   "/api/films/1",
+			Token:  "admin",
+			Body:   CR{"name": "Alien", "date": 1979, "rating": 8, "actors": []CR{{"id": 7}}},
+			Status: http.StatusUnprocessableEntity,
+			Result: CR{"error": "actor not exist"},
+		},
+		{
+			Name:   "rating out of range",
+			Method: http.MethodPost,
+			Path:   "/api/films/1",
+			Token:  "admin",
+			Body:   CR{"name": "Alien", "date": 1979, "rating": 11},
+			Status: http.StatusUnprocessableEntity,
+			Result: CR{"error": "incorrect film rating"},
+		},
+		{
+			Name:   "user lists films",
+			Method: http.MethodGet,
+			Path:   "/api/films",
+			Token:  "hello",
+			Status: http.StatusOK,
+			Result: CR{"total": 1, "data": []interface{}{CR{"id": 1, "name": "Alien", "description": "", "date": 1979, "rating": 8, "actors": nil}}},
+		},
+		{
+			Name:   "user lists films with facets",
+			Method: http.MethodGet,
+			Path:   "/api/films?limit=1&facets=1",
+			Token:  "hello",
+			Status: http.StatusOK,
+			Result: CR{
+				"total":  1,
+				"data":   []interface{}{CR{"id": 1, "name": "Alien", "description": "", "date": 1979, "rating": 8, "actors": nil}},
+				"facets": CR{"decades": []CR{{"decade": 1970, "count": 1}}, "ratings": []CR{{"from": 7, "to": 8, "count": 1}}, "actors": []CR{}},
+			},
+		},
+		{
+			Name:   "user filters films",
+			Method: http.MethodGet,
+			Path:   "/api/films?date_from=1980&name_prefix=al",
+			Token:  "hello",
+			Status: http.StatusOK,
+			Result: CR{"total": 0, "data": nil},
+		},
+		{
+			Name:   "bad filter",
+			Method: http.MethodGet,
+			Path:   "/api/films?rating_from=9&rating_to=5",
+			Token:  "hello",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "incorrect filter: rating_from"},
+		},
+		{
+			Name:   "bad limit",
+			Method: http.MethodGet,
+			Path:   "/api/films?limit=0",
+			Token:  "hello",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "incorrect limit"},
+		},
+		{
+			Name:   "actor search needs a name",
+			Method: http.MethodGet,
+			Path:   "/api/actors/search?gender=female",
+			Token:  "hello",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "empty search"},
+		},
+		{
+			Name:   "bad birth date",
+			Method: http.MethodGet,
+			Path:   "/api/actors/search?name=a&born_to=1.1.1970",
+			Token:  "hello",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "incorrect filter: born_to"},
+		},
+		{
+			Name:   "fuzzy search",
+			Method: http.MethodGet,
+			Path:   "/api/films/search?query=Allien&mode=fuzzy",
+			Token:  "hello",
+			Status: http.StatusOK,
+			Result: CR{"data": []CR{{"id": 1, "name": "Alien", "description": "", "date": 1979, "rating": 8, "actors": nil, "score": 0.714}}},
+		},
+		{
+			Name:   "query search",
+			Method: http.MethodGet,
+			Path:   "/api/films/search?mode=query&query=" + url.QueryEscape("year:>=1979 rating:>7 -title:aliens"),
+			Token:  "hello",
+			Status: http.StatusOK,
+			Result: CR{"data": []CR{{"id": 1, "name": "Alien", "description": "", "date": 1979, "rating": 8, "actors": nil}}},
+		},
+		{
+			Name:   "query syntax error",
+			Method: http.MethodGet,
+			Path:   "/api/films/search?mode=query&query=" + url.QueryEscape("year:>=1979 rating:>high"),
+			Token:  "hello",
+			Status: http.StatusBadRequest,
+			Result: CR{"status": 400, "errors": []CR{{"param": "query", "msg": `rating must be a whole number, got "high"`, "pos": 21}}},
+		},
+		{
+			Name:   "search with facets",
+			Method: http.MethodGet,
+			Path:   "/api/films/search?query=Alien&facets=true",
+			Token:  "hello",
+			Status: http.StatusOK,
+			Result: CR{
+				"data":   []CR{{"id": 1, "name": "Alien", "description": "", "date": 1979, "rating": 8, "actors": nil, "snippet": "<b>Alien</b>"}},
+				"facets": CR{"decades": []CR{{"decade": 1970, "count": 1}}, "ratings": []CR{{"from": 7, "to": 8, "count": 1}}, "actors": []CR{}},
+			},
+		},
+		{
+			Name:   "bad facets",
+			Method: http.MethodGet,
+			Path:   "/api/films?facets=maybe",
+			Token:  "hello",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "incorrect facets"},
+		},
+		{
+			Name:   "bad search mode",
+			Method: http.MethodGet,
+			Path:   "/api/films/search?query=Alien&mode=regex",
+			Token:  "hello",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "incorrect mode"},
+		},
+		{
+			Name:   "suggest",
+			Method: http.MethodGet,
+			Path:   "/api/suggest?q=ali",
+			Token:  "hello",
+			Status: http.StatusOK,
+			Result: CR{"data": []CR{{"type": "film", "id": 1, "name": "Alien", "score": 1.6}}},
+		},
+		{
+			Name:   "suggest needs text",
+			Method: http.MethodGet,
+			Path:   "/api/suggest",
+			Token:  "hello",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "empty search"},
+		},
+		{
+			Name:   "bad cursor",
+			Method: http.MethodGet,
+			Path:   "/api/actors?cursor=garbage",
+			Token:  "hello",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "incorrect cursor"},
+		},
+		{
+			Name:   "user cannot delete film",
+			Method: http.MethodDelete,
+			Path:   "/api/films/1",
+			Token:  "hello",
+			Status: http.StatusForbidden,
+		},
+		{
+			Name:   "admin deletes film",
+			Method: http.MethodDelete,
+			Path:   "/api/films/1",
+			Token:  "admin",
+			Status: http.StatusOK,
+			Result: CR{"data": 1},
+		},
+		{
+			Name:   "user cannot read trash",
+			Method: http.MethodGet,
+			Path:   "/api/trash",
+			Token:  "hello",
+			Status: http.StatusForbidden,
+		},
+	}
+
+	runStackCases(t, ts, cases)
+}
+
+func TestMapStackPages(t *testing.T) {
+	useTestKeys(t)
+
+	itemRepo := items.NewMapRepo()
+	for _, film := range []items.Film{
+		{Name: "b", Date: 2000, Rating: 5},
+		{Name: "a", Date: nil, Rating: nil},
+		{Name: "b", Date: 2000, Rating: 5},
+		{Name: "c", Date: 1990, Rating: 9},
+		{Name: "a", Date: 2010, Rating: 1},
+	} {
+		if _, err := itemRepo.CreateFilm(film); err != nil {
+			t.Fatalf("CreateFilm: %v", err)
+		}
+	}
+
+	handler, err := explorer.NewRepoExplorer(itemRepo, users.NewMapRepo(), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewRepoExplorer: %v", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	cases := []struct {
+		query string
+		want  []float64
+	}{
+		{"field=rating&order=-1", []float64{2, 4, 3, 1, 5}},
+		{"field=name&order=1", []float64{2, 5, 1, 3, 4}},
+		{"field=name&order=-1", []float64{4, 3, 1, 5, 2}},
+		{"field=date&order=1", []float64{4, 1, 3, 5, 2}},
+		{"field=date&order=-1", []float64{2, 5, 3, 1, 4}},
+	}
+	for _, c := range cases {
+		var ids []float64
+		path := "/api/films?limit=2&" + c.query
+		for pages := 0; path != ""; pages++ {
+			if pages > 5 {
+				t.Fatalf("%s: pagination does not stop", c.query)
+			}
+
+			resp, err := client.Get(ts.URL + path)
+			if err != nil {
+				t.Fatalf("request error: %v", err)
+			}
+
+			var page struct {
+				Data       []CR   `json:"data"`
+				NextCursor string `json:"next_cursor"`
+				Total      int    `json:"total"`
+			}
+			err = json.NewDecoder(resp.Body).Decode(&page)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("cant unpack json: %v", err)
+			}
+
+			if page.Total != 5 {
+				t.Fatalf("%s: expected total 5, got %d", c.query, page.Total)
+			}
+			for _, film := range page.Data {
+				ids = append(ids, film["id"].(float64))
+			}
+
+			path = ""
+			if page.NextCursor != "" {
+				if !strings.Contains(resp.Header.Get("Link"), `rel="next"`) {
+					t.Fatalf("%s: no next link in %q", c.query, resp.Header.Get("Link"))
+				}
+				path = "/api/films?limit=2&" + c.query + "&cursor=" + page.NextCursor
+			}
+		}
+
+		if !reflect.DeepEqual(ids, c.want) {
+			t.Fatalf("%s: expected films %v, got %v", c.query, c.want, ids)
+		}
+	}
+
+	// a cursor only fits the ordering it was issued for
+	resp, err := client.Get(ts.URL + "/api/films?limit=2&field=rating&order=-1")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	var page struct {
+		NextCursor string `json:"next_cursor"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("cant unpack json: %v", err)
+	}
+	resp, err = client.Get(ts.URL + "/api/films?limit=2&field=name&order=-1&cursor=" + page.NextCursor)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("rating cursor with field=name: expected 400, got %d", resp.StatusCode)
+	}
+}
+
+// slowSuggestRepo answers suggestions only after the request gives up.
+type slowSuggestRepo struct {
+	items.ItemRepo
+}
+
+func (repo slowSuggestRepo) Suggest(ctx context.Context, query string, limit int) ([]items.Suggestion, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestMapStackSuggestTimeout(t *testing.T) {
+	useTestKeys(t)
+
+	t.Setenv("SUGGEST_TIMEOUT", "10ms")
+
+	handler, err := explorer.NewRepoExplorer(slowSuggestRepo{items.NewMapRepo()}, users.NewMapRepo(), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("NewRepoExplorer: %v", err)
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	runStackCases(t, ts, []StackCase{
+		{
+			Name:   "suggest over budget",
+			Method: http.MethodGet,
+			Path:   "/api/suggest?q=ali",
+			Status: http.StatusServiceUnavailable,
+			Result: CR{"error": "suggestions took too long"},
+		},
+	})
+}
+
+func runStackCases(t *testing.T, ts *httptest.Server, cases []StackCase) {
+	t.Helper()
+
+	tokens := make(map[string]string)
+	for _, item := range cases {
+		var body io.Reader
+		if item.Body != nil {
+			data, err := json.Marshal(item.Body)
+			if err != nil {
+				t.Fatalf("[%s] cant marshal body: %v", item.Name, err)
+			}
+			body = bytes.NewReader(data)
+		}
+
+		req, err := http.NewRequest(item.Method, ts.URL+item.Path, body)
+		if err != nil {
+			t.Fatalf("[%s] cant create request: %v", item.Name, err)
+		}
+		if item.Token != "" {
+			req.Header.Set("Authorization", tokens[item.Token])
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("[%s] request error: %v", item.Name, err)
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("[%s] error readall: %v", item.Name, err)
+		}
+
+		if resp.StatusCode != item.Status {
+			t.Fatalf("[%s] expected http status %v, got %v: %s", item.Name, item.Status, resp.StatusCode, respBody)
+		}
+
+		if item.Login != "" {
+			tokens[item.Login] = resp.Header.Get("Authorization")
+		}
+
+		if item.Result == nil {
+			continue
+		}
+
+		var result, expected interface{}
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			t.Fatalf("[%s] cant unpack json: %v", item.Name, err)
+		}
+
+		data, err := json.Marshal(item.Result)
+		if err != nil {
+			t.Fatalf("[%s] cant marshal result json: %v", item.Name, err)
+		}
+		if err := json.Unmarshal(data, &expected); err != nil {
+			t.Fatalf("[%s] cant unmarshal expected json: %v", item.Name, err)
+		}
+
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("[%s] results not match\nGot : %#v\nWant: %#v", item.Name, result, expected)
+		}
+	}
+}
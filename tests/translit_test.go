@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"filmlibrary/pkg/translit"
+	"testing"
+)
+
+func TestNormalizeMatchesTransliterations(t *testing.T) {
+	pairs := []struct {
+		cyrillic string
+		latin    string
+	}{
+		{"Том Хэнкс", "Tom Hanks"},
+		{"Леонардо Ди Каприо", "Leonardo DiCaprio"},
+		{"Шерлок Холмс", "Sherlock Holmes"},
+		{"Чарли Чаплин", "Charlie Chaplin"},
+		{"Джонни Депп", "Johnny Depp"},
+		{"Брат", "Brat"},
+	}
+
+	for _, pair := range pairs {
+		cyrillic, latin := translit.Normalize(pair.cyrillic), translit.Normalize(pair.latin)
+		if cyrillic != latin {
+			t.Errorf("Normalize(%q) = %q, Normalize(%q) = %q", pair.cyrillic, cyrillic, pair.latin, latin)
+		}
+	}
+}
+
+func TestNormalizeKeepsDistinctNames(t *testing.T) {
+	if a, b := translit.Normalize("Tom Hanks"), translit.Normalize("Matt Damon"); a == b {
+		t.Fatalf("Normalize: %q and %q both give %q", "Tom Hanks", "Matt Damon", a)
+	}
+	if key := translit.Normalize("Heat"); len(key) >= translit.MinKeyLen {
+		t.Fatalf("Normalize(Heat) = %q, expected a key shorter than %d", key, translit.MinKeyLen)
+	}
+}
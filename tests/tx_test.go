@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"errors"
+	"filmlibrary/pkg/items"
+	"testing"
+)
+
+func TestFilmWritesRollback(t *testing.T) {
+	db := openInstrumentedDB(t)
+	defer db.Close()
+
+	PrepareFilms(db)
+	repo := items.NewMemoryRepo(db)
+
+	first := mustCreateActor(t, repo, items.Actor{Name: "Ripley", Date: ""})
+	second := mustCreateActor(t, repo, items.Actor{Name: "Bishop", Date: ""})
+	filmID := mustCreateFilm(t, repo, items.Film{Name: "Alien", Actors: []items.Actor{{ID: first}}})
+
+	failQueries(t, "INSERT INTO film_actor")
+
+	if _, err := repo.CreateFilm(items.Film{Name: "Aliens", Actors: []items.Actor{{ID: second}}}); !errors.Is(err, errInjected) {
+		t.Fatalf("CreateFilm: expected injected failure, got %v", err)
+	}
+
+	if _, total, _ := repo.GetFilms("rating", -1, items.FilmFilter{}, items.Page{}); total != 1 {
+		t.Fatalf("CreateFilm left a film without cast: %d films", total)
+	}
+
+	if err := repo.UpdateFilm(items.Film{ID: filmID, Name: "Aliens", Actors: []items.Actor{{ID: second}}}); !errors.Is(err, errInjected) {
+		t.Fatalf("UpdateFilm: expected injected failure, got %v", err)
+	}
+
+	if err := repo.ReplaceActors(filmID, []items.Actor{{ID: second}}); !errors.Is(err, errInjected) {
+		t.Fatalf("ReplaceActors: expected injected failure, got %v", err)
+	}
+
+	film, err := repo.GetFilmByID(filmID)
+	if err != nil {
+		t.Fatalf("GetFilmByID: %v", err)
+	}
+	if film.Name != "Alien" {
+		t.Fatalf("UpdateFilm was not rolled back: %#v", film)
+	}
+	if got := actorIDs(film.Actors); !equalIDs(got, []uint32{first}) {
+		t.Fatalf("cast was not rolled back: %v", got)
+	}
+}
@@ -0,0 +1,449 @@
+package tests
+
+import (
+	"database/sql"
+	"filmlibrary/pkg/errs"
+	"filmlibrary/pkg/users"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// userRepoFactory returns a repository holding only the admin user for every subtest.
+type userRepoFactory func(t *testing.T) users.UserRepo
+
+func TestUserMapRepository(t *testing.T) {
+	runUserRepoConformance(t, func(t *testing.T) users.UserRepo {
+		return sessionUsers(t)
+	})
+}
+
+func TestUserMemoryRepository(t *testing.T) {
+	DSN := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable",
+		user, password, host, dbname)
+
+	db, err := sql.Open("postgres", DSN)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		t.Skipf("postgres is not available: %v", err)
+	}
+
+	runUserRepoConformance(t, func(t *testing.T) users.UserRepo {
+		PrepareSchema(db)
+		return users.NewMemoryRepo(db)
+	})
+}
+
+func runUserRepoConformance(t *testing.T, newRepo userRepoFactory) {
+	t.Run("user by id", func(t *testing.T) { testUserRepoByID(t, newRepo(t)) })
+	t.Run("refresh tokens", func(t *testing.T) { testUserRepoRefreshTokens(t, newRepo(t)) })
+	t.Run("sessions", func(t *testing.T) { testUserRepoSessions(t, newRepo(t)) })
+	t.Run("admin", func(t *testing.T) { testUserRepoAdmin(t, newRepo(t)) })
+	t.Run("change password", func(t *testing.T) { testUserRepoChangePassword(t, newRepo(t)) })
+	t.Run("login attempts", func(t *testing.T) { testUserRepoLoginAttempts(t, newRepo(t)) })
+}
+
+func testUserRepoByID(t *testing.T, repo users.UserRepo) {
+	admin, err := repo.GetUserByUsername("admin")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+
+	byID, err := repo.GetUserByID(admin.ID)
+	if err != nil || byID.Login != "admin" || byID.Role != "admin" {
+		t.Fatalf("GetUserByID: got %+v, %v", byID, err)
+	}
+
+	if _, err := repo.GetUserByID(1000); err == nil || err.Error() != errs.UserNotExist {
+		t.Fatalf("GetUserByID(1000): expected %q, got %v", errs.UserNotExist, err)
+	}
+}
+
+func testUserRepoRefreshTokens(t *testing.T, repo users.UserRepo) {
+	admin, err := repo.GetUserByUsername("admin")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	token := func(hash, jti string) users.RefreshToken {
+		return users.RefreshToken{
+			Hash:            fmt.Sprintf("%064s", hash),
+			AccessID:        jti,
+			AccessExpiresAt: now.Add(time.Minute),
+			ExpiresAt:       now.Add(time.Hour),
+		}
+	}
+
+	first := token("1", "jti-1")
+	first.Family, first.UserID = "family", admin.ID
+	if err := repo.CreateSession(users.Session{ID: "family", UserID: admin.ID, CreatedAt: now}, first); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	second, err := repo.RotateRefreshToken(first.Hash, token("2", "jti-2"), now)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	if second.Family != "family" || second.UserID != admin.ID {
+		t.Fatalf("RotateRefreshToken: expected the family of the spent token, got %+v", second)
+	}
+
+	if _, err := repo.RotateRefreshToken(token("missing", "").Hash, token("3", "jti-3"), now); err == nil || err.Error() != errs.InvalidRefreshToken {
+		t.Fatalf("unknown token: expected %q, got %v", errs.InvalidRefreshToken, err)
+	}
+
+	expired := token("4", "jti-4")
+	expired.Family, expired.UserID, expired.ExpiresAt = "other", admin.ID, now.Add(-time.Second)
+	if err := repo.CreateSession(users.Session{ID: "other", UserID: admin.ID, CreatedAt: now}, expired); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := repo.RotateRefreshToken(expired.Hash, token("5", "jti-5"), now); err == nil || err.Error() != errs.InvalidRefreshToken {
+		t.Fatalf("expired token: expected %q, got %v", errs.InvalidRefreshToken, err)
+	}
+
+	if revoked, _ := repo.TokenRevoked("jti-2"); revoked {
+		t.Fatalf("jti-2 revoked before any reuse")
+	}
+
+	if _, err := repo.RotateRefreshToken(first.Hash, token("6", "jti-6"), now); err == nil || err.Error() != errs.RefreshTokenReused {
+		t.Fatalf("reused token: expected %q, got %v", errs.RefreshTokenReused, err)
+	}
+	for _, jti := range []string{"jti-1", "jti-2"} {
+		if revoked, err := repo.TokenRevoked(jti); err != nil || !revoked {
+			t.Fatalf("%s of the reused family: expected revoked, got %v, %v", jti, revoked, err)
+		}
+	}
+	if _, err := repo.RotateRefreshToken(second.Hash, token("7", "jti-7"), now); err == nil || err.Error() != errs.InvalidRefreshToken {
+		t.Fatalf("token of a revoked family: expected %q, got %v", errs.InvalidRefreshToken, err)
+	}
+
+	if err := repo.RevokeFamily("other", now); err != nil {
+		t.Fatalf("RevokeFamily: %v", err)
+	}
+	if revoked, _ := repo.TokenRevoked("jti-4"); !revoked {
+		t.Fatalf("jti-4: expected revoked with its family")
+	}
+	if revoked, _ := repo.TokenRevoked("jti-unknown"); revoked {
+		t.Fatalf("unknown jti reported revoked")
+	}
+
+	// revoking once the access tokens above have expired forgets their jtis
+	later := token("8", "jti-8")
+	later.Family, later.UserID = "later", admin.ID
+	if err := repo.CreateSession(users.Session{ID: "later", UserID: admin.ID, CreatedAt: now}, later); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := repo.RevokeFamily("later", now.Add(time.Minute)); err != nil {
+		t.Fatalf("RevokeFamily: %v", err)
+	}
+	for _, jti := range []string{"jti-1", "jti-2", "jti-4", "jti-8"} {
+		if revoked, _ := repo.TokenRevoked(jti); revoked {
+			t.Fatalf("%s: expected an expired jti to be pruned", jti)
+		}
+	}
+}
+
+func testUserRepoSessions(t *testing.T, repo users.UserRepo) {
+	admin, err := repo.GetUserByUsername("admin")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	start := func(id, hash string, createdAt time.Time) {
+		t.Helper()
+
+		session := users.Session{ID: id, UserID: admin.ID, UserAgent: "curl/8.0", IP: "192.0.2.1", CreatedAt: createdAt}
+		token := users.RefreshToken{
+			Hash:            fmt.Sprintf("%064s", hash),
+			Family:          id,
+			UserID:          admin.ID,
+			AccessID:        "jti-" + hash,
+			AccessExpiresAt: createdAt.Add(time.Minute),
+			ExpiresAt:       createdAt.Add(time.Hour),
+		}
+		if err := repo.CreateSession(session, token); err != nil {
+			t.Fatalf("CreateSession(%s): %v", id, err)
+		}
+	}
+
+	start("laptop", "1", now.Add(-time.Hour/2))
+	start("phone", "2", now.Add(-time.Hour/4))
+	start("stale", "3", now.Add(-2*time.Hour))
+
+	if active, err := repo.TouchSession("laptop", now); err != nil || !active {
+		t.Fatalf("TouchSession(laptop): got %v, %v", active, err)
+	}
+	if active, _ := repo.TouchSession("stale", now); active {
+		t.Fatalf("TouchSession(stale): expected an expired session to be inactive")
+	}
+	if active, _ := repo.TouchSession("missing", now); active {
+		t.Fatalf("TouchSession(missing): expected inactive")
+	}
+
+	sessions, err := repo.ListSessions(admin.ID, now)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "laptop" || sessions[1].ID != "phone" {
+		t.Fatalf("ListSessions: expected laptop then phone, got %+v", sessions)
+	}
+	if laptop := sessions[0]; !laptop.LastSeenAt.Equal(now) || laptop.UserAgent != "curl/8.0" || laptop.IP != "192.0.2.1" {
+		t.Fatalf("ListSessions: unexpected laptop session %+v", laptop)
+	}
+
+	if revoked, err := repo.RevokeSessions(admin.ID, "missing", now); err != nil || revoked != 0 {
+		t.Fatalf("RevokeSessions(missing): got %v, %v", revoked, err)
+	}
+	if revoked, err := repo.RevokeSessions(admin.ID+1, "phone", now); err != nil || revoked != 0 {
+		t.Fatalf("RevokeSessions of another user: got %v, %v", revoked, err)
+	}
+	if revoked, err := repo.RevokeSessions(admin.ID, "phone", now); err != nil || revoked != 1 {
+		t.Fatalf("RevokeSessions(phone): got %v, %v", revoked, err)
+	}
+	if active, _ := repo.TouchSession("phone", now); active {
+		t.Fatalf("TouchSession(phone): expected a revoked session to be inactive")
+	}
+	next := users.RefreshToken{Hash: fmt.Sprintf("%064s", "6"), AccessID: "jti-6", AccessExpiresAt: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)}
+	if _, err := repo.RotateRefreshToken(fmt.Sprintf("%064s", "2"), next, now); err == nil || err.Error() != errs.InvalidRefreshToken {
+		t.Fatalf("token of a revoked session: expected %q, got %v", errs.InvalidRefreshToken, err)
+	}
+
+	if err := repo.RevokeFamily("laptop", now); err != nil {
+		t.Fatalf("RevokeFamily: %v", err)
+	}
+	if sessions, _ := repo.ListSessions(admin.ID, now); len(sessions) != 0 {
+		t.Fatalf("ListSessions after logout: expected none, got %+v", sessions)
+	}
+
+	start("tablet", "4", now)
+	start("desktop", "5", now)
+	if revoked, err := repo.RevokeSessions(admin.ID, "", now); err != nil || revoked != 2 {
+		t.Fatalf("RevokeSessions(all): got %v, %v", revoked, err)
+	}
+}
+
+func testUserRepoAdmin(t *testing.T, repo users.UserRepo) {
+	for _, name := range []string{"alice", "bob", "alina", "al_x"} {
+		if _, err := repo.Signup(name, "MySuperSecretPassword"); err != nil {
+			t.Fatalf("Signup(%s): %v", name, err)
+		}
+	}
+
+	logins := func(accounts []users.Account) []string {
+		names := make([]string, 0, len(accounts))
+		for _, account := range accounts {
+			names = append(names, account.Login)
+		}
+		return names
+	}
+
+	accounts, total, err := repo.ListUsers(users.UserFilter{Search: "AL", Limit: 2})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if total != 3 || fmt.Sprint(logins(accounts)) != "[alice alina]" {
+		t.Fatalf("ListUsers(al): got %v of %d", logins(accounts), total)
+	}
+	if accounts[0].Role != "viewer" || accounts[0].Disabled {
+		t.Fatalf("ListUsers: expected an enabled viewer, got %+v", accounts[0])
+	}
+
+	accounts, total, _ = repo.ListUsers(users.UserFilter{Search: "al", AfterID: accounts[1].ID, Limit: 2})
+	if total != 3 || fmt.Sprint(logins(accounts)) != "[al_x]" {
+		t.Fatalf("ListUsers(al) second page: got %v of %d", logins(accounts), total)
+	}
+	if accounts, _, _ := repo.ListUsers(users.UserFilter{Search: "l_", Limit: 10}); fmt.Sprint(logins(accounts)) != "[al_x]" {
+		t.Fatalf("ListUsers(l_): expected the wildcard to match literally, got %v", logins(accounts))
+	}
+	if accounts, total, _ := repo.ListUsers(users.UserFilter{Role: "admin", Limit: 10}); total != 1 || accounts[0].Login != "admin" {
+		t.Fatalf("ListUsers(role admin): got %v of %d", logins(accounts), total)
+	}
+
+	bob, err := repo.GetUserByUsername("bob")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+
+	if err := repo.SetUserRole(bob.ID, "editor"); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	if user, _ := repo.GetUserByID(bob.ID); user.Role != "editor" {
+		t.Fatalf("SetUserRole: expected editor, got %q", user.Role)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	token := users.RefreshToken{
+		Hash:            fmt.Sprintf("%064s", "bob"),
+		Family:          "bob-laptop",
+		UserID:          bob.ID,
+		AccessID:        "jti-bob",
+		AccessExpiresAt: now.Add(time.Minute),
+		ExpiresAt:       now.Add(time.Hour),
+	}
+	if err := repo.CreateSession(users.Session{ID: "bob-laptop", UserID: bob.ID, CreatedAt: now}, token); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	if err := repo.SetUserDisabled(bob.ID, true, now); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+	if _, err := repo.Authorize("bob", "MySuperSecretPassword"); err == nil || err.Error() != errs.UserDisabled {
+		t.Fatalf("Authorize disabled: expected %q, got %v", errs.UserDisabled, err)
+	}
+	if active, _ := repo.TouchSession("bob-laptop", now); active {
+		t.Fatalf("TouchSession: expected disabling to end the sessions")
+	}
+	if revoked, _ := repo.TokenRevoked("jti-bob"); !revoked {
+		t.Fatalf("jti-bob: expected revoked when disabled")
+	}
+
+	if err := repo.SetUserDisabled(bob.ID, false, now); err != nil {
+		t.Fatalf("SetUserDisabled(false): %v", err)
+	}
+	if user, err := repo.Authorize("bob", "MySuperSecretPassword"); err != nil || user.Disabled {
+		t.Fatalf("Authorize enabled: got %+v, %v", user, err)
+	}
+
+	if err := repo.DeleteUser(bob.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := repo.GetUserByID(bob.ID); err == nil || err.Error() != errs.UserNotExist {
+		t.Fatalf("GetUserByID after delete: expected %q, got %v", errs.UserNotExist, err)
+	}
+
+	for name, err := range map[string]error{
+		"SetUserRole":     repo.SetUserRole(1000, "editor"),
+		"SetUserDisabled": repo.SetUserDisabled(1000, true, now),
+		"DeleteUser":      repo.DeleteUser(1000),
+	} {
+		if err == nil || err.Error() != errs.UserNotExist {
+			t.Fatalf("%s(1000): expected %q, got %v", name, errs.UserNotExist, err)
+		}
+	}
+}
+
+func testUserRepoChangePassword(t *testing.T, repo users.UserRepo) {
+	admin, err := repo.GetUserByUsername("admin")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	for i, id := range []string{"current", "other"} {
+		token := users.RefreshToken{
+			Hash:            fmt.Sprintf("%064d", i),
+			Family:          id,
+			UserID:          admin.ID,
+			AccessID:        "jti-" + id,
+			AccessExpiresAt: now.Add(time.Minute),
+			ExpiresAt:       now.Add(time.Hour),
+		}
+		if err := repo.CreateSession(users.Session{ID: id, UserID: admin.ID, CreatedAt: now}, token); err != nil {
+			t.Fatalf("CreateSession(%s): %v", id, err)
+		}
+	}
+
+	if err := repo.ChangePassword(admin.ID, "AnotherSecretPassword", "current", now); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+
+	if _, err := repo.Authorize("admin", "AnotherSecretPassword"); err != nil {
+		t.Fatalf("Authorize with the new password: %v", err)
+	}
+	if _, err := repo.Authorize("admin", "MySuperSecretPassword"); err == nil || err.Error() != errs.BadPass {
+		t.Fatalf("Authorize with the old password: expected %q, got %v", errs.BadPass, err)
+	}
+
+	if active, _ := repo.TouchSession("current", now); !active {
+		t.Fatalf("the session changing the password: expected it to stay")
+	}
+	if active, _ := repo.TouchSession("other", now); active {
+		t.Fatalf("other session: expected it to end")
+	}
+
+	if err := repo.ChangePassword(1000, "AnotherSecretPassword", "", now); err == nil || err.Error() != errs.UserNotExist {
+		t.Fatalf("ChangePassword(1000): expected %q, got %v", errs.UserNotExist, err)
+	}
+}
+
+func testUserRepoLoginAttempts(t *testing.T, repo users.UserRepo) {
+	now := time.Now().Truncate(time.Second)
+
+	if attempt, err := repo.LoginAttempt("user:admin"); err != nil || attempt.Failures != 0 || !attempt.BlockedUntil.IsZero() {
+		t.Fatalf("LoginAttempt without failures: got %+v, %v", attempt, err)
+	}
+
+	fail := func(attempts []*users.LoginAttempt) {
+		for _, attempt := range attempts {
+			attempt.Failures++
+			attempt.LastFailure = now
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := repo.UpdateLogins([]string{"user:admin", "ip:192.0.2.1"}, fail); err != nil {
+			t.Fatalf("UpdateLogins: %v", err)
+		}
+	}
+
+	until := now.Add(time.Minute)
+	err := repo.UpdateLogins([]string{"user:admin"}, func(attempts []*users.LoginAttempt) {
+		if attempts[0].Key != "user:admin" || attempts[0].Failures != 3 || !attempts[0].LastFailure.Equal(now) {
+			t.Errorf("UpdateLogins: expected the stored attempt, got %+v", attempts[0])
+		}
+		attempts[0].BlockedUntil, attempts[0].Locked = until, true
+	})
+	if err != nil {
+		t.Fatalf("UpdateLogins: %v", err)
+	}
+	attempt, err := repo.LoginAttempt("user:admin")
+	if err != nil || attempt.Failures != 3 || !attempt.BlockedUntil.Equal(until) || !attempt.Locked {
+		t.Fatalf("LoginAttempt after a block: got %+v, %v", attempt, err)
+	}
+	if other, _ := repo.LoginAttempt("ip:198.51.100.7"); other.Failures != 0 {
+		t.Fatalf("LoginAttempt of another key: got %+v", other)
+	}
+
+	// an attempt left empty is forgotten
+	err = repo.UpdateLogins([]string{"ip:192.0.2.1"}, func(attempts []*users.LoginAttempt) {
+		attempts[0].Failures = 0
+	})
+	if err != nil {
+		t.Fatalf("UpdateLogins: %v", err)
+	}
+	if attempt, _ := repo.LoginAttempt("ip:192.0.2.1"); attempt.Failures != 0 || !attempt.LastFailure.IsZero() {
+		t.Fatalf("LoginAttempt after emptying it: got %+v", attempt)
+	}
+
+	// pruning spares blocked keys and recent failures
+	if err := repo.UpdateLogins([]string{"ip:192.0.2.1"}, fail); err != nil {
+		t.Fatalf("UpdateLogins: %v", err)
+	}
+	if err := repo.PruneLogins(now.Add(time.Hour), now); err != nil {
+		t.Fatalf("PruneLogins: %v", err)
+	}
+	if attempt, _ := repo.LoginAttempt("user:admin"); attempt.Failures != 3 {
+		t.Fatalf("LoginAttempt of a blocked key after PruneLogins: got %+v", attempt)
+	}
+	if attempt, _ := repo.LoginAttempt("ip:192.0.2.1"); attempt.Failures != 0 {
+		t.Fatalf("LoginAttempt of a quiet key after PruneLogins: got %+v", attempt)
+	}
+	if err := repo.PruneLogins(now, until.Add(time.Minute)); err != nil {
+		t.Fatalf("PruneLogins: %v", err)
+	}
+	if attempt, _ := repo.LoginAttempt("user:admin"); attempt.Failures != 3 {
+		t.Fatalf("LoginAttempt of a recent key after PruneLogins: got %+v", attempt)
+	}
+
+	if err := repo.ResetLogin("user:admin"); err != nil {
+		t.Fatalf("ResetLogin: %v", err)
+	}
+	if attempt, _ := repo.LoginAttempt("user:admin"); attempt.Failures != 0 || attempt.Locked {
+		t.Fatalf("LoginAttempt after ResetLogin: got %+v", attempt)
+	}
+}
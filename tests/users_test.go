@@ -42,53 +42,11 @@ var (
 	client = &http.Client{Timeout: time.Second}
 )
 
-func PrepareTestApis(db *sql.DB) {
-	qs := []string{
-		`DROP TABLE IF EXISTS users;`,
-		`CREATE TABLE users (
-			id SERIAL PRIMARY KEY,
-			username VARCHAR(50) NOT NULL,
-			role VARCHAR(50) NOT NULL DEFAULT 'user',
-			hashed_password VARCHAR(255) NOT NULL
-		);`,
-
-		`INSERT INTO users (username, role, hashed_password) VALUES
-		('admin', 'admin','$2a$10$GJJT0w7LaC4oOfTygVVi8Ofn8D5kZHTXWdhA8PzscqkK846A2oG.C');`,
-	}
-
-	for _, q := range qs {
-		_, err := db.Exec(q)
-		if err != nil {
-			panic(err)
-		}
-	}
-}
-
-func PrepareTestUsers2(db *sql.DB) {
-	qs := []string{
-		`DROP TABLE IF EXISTS users;`,
-		`CREATE TABLE users (
-			id SERIAL PRIMARY KEY,
-			username VARCHAR(50) NOT NULL,
-			role VARCHAR(50) NOT NULL DEFAULT 'user',
-			password VARCHAR(255) NOT NULL
-		);`,
-
-		`INSERT INTO users (username, role, password) VALUES
-		('admin', 'admin','$2a$10$GJJT0w7LaC4oOfTygVVi8Ofn8D5kZHTXWdhA8PzscqkK846A2oG.C');`,
-	}
-
-	for _, q := range qs {
-		_, err := db.Exec(q)
-		if err != nil {
-			panic(err)
-		}
-	}
-}
+// CleanupTestApis drops everything the tests created.
 func CleanupTestApis(db *sql.DB) {
 	qs := []string{
-		`DROP TABLE IF EXISTS items;`,
-		`DROP TABLE IF EXISTS users;`,
+		`DROP SCHEMA public CASCADE;`,
+		`CREATE SCHEMA public;`,
 	}
 	for _, q := range qs {
 		_, err := db.Exec(q)
@@ -99,6 +57,8 @@ func CleanupTestApis(db *sql.DB) {
 }
 
 func TestUsers(t *testing.T) {
+	useTestKeys(t)
+
 	zapLogger, err := zap.NewProduction()
 	if err != nil {
 		log.Fatalf("failed to create logger: %v", err)
@@ -127,7 +87,7 @@ func TestUsers(t *testing.T) {
 		panic(err)
 	}
 
-	PrepareTestApis(db)
+	PrepareSchema(db)
 
 	// возможно вам будет удобно закомментировать это, чтобы смотреть результат после теста
 	defer CleanupTestApis(db)
@@ -157,7 +117,17 @@ func TestUsers(t *testing.T) {
 				"username": "hello",
 				"password": "privetMir",
 			},
-			Status: http.StatusUnprocessableEntity,
+			Status: http.StatusConflict,
+			Result: CR{"error": "user already exists"},
+		},
+		Case{
+			Path:   "/api/register",
+			Method: http.MethodPost,
+			Body: CR{
+				"username": "HeLLo",
+				"password": "privetMir",
+			},
+			Status: http.StatusConflict,
 			Result: CR{"error": "user already exists"},
 		},
 		Case{
@@ -221,7 +191,7 @@ func TestUsers(t *testing.T) {
 			Body: CR{
 				"username": "admin",
 				"password": "privetMir"},
-			Status: http.StatusUnprocessableEntity,
+			Status: http.StatusConflict,
 			Result: CR{"error": "user already exists"},
 		},
 		Case{
@@ -266,6 +236,8 @@ func TestUsers(t *testing.T) {
 }
 
 func TestUsers2(t *testing.T) {
+	useTestKeys(t)
+
 	zapLogger, err := zap.NewProduction()
 	if err != nil {
 		log.Fatalf("failed to create logger: %v", err)
@@ -294,7 +266,11 @@ func TestUsers2(t *testing.T) {
 		panic(err)
 	}
 
-	PrepareTestUsers2(db)
+	// the stored password hash goes missing from under the repository
+	PrepareSchema(db)
+	if _, err := db.Exec("ALTER TABLE users RENAME COLUMN hashed_password TO password"); err != nil {
+		panic(err)
+	}
 
 	// возможно вам будет удобно закомментировать это, чтобы смотреть результат после теста
 	defer CleanupTestApis(db)
@@ -359,7 +335,11 @@ func runCases(t *testing.T, ts *httptest.Server, db *sql.DB, cases []Case) {
 			}
 			reqBody := bytes.NewReader(data)
 			var errNewReq error
-			req, errNewReq = http.NewRequest(item.Method, ts.URL+item.Path, reqBody)
+			url := ts.URL + item.Path
+			if item.Query != "" {
+				url += "?" + item.Query
+			}
+			req, errNewReq = http.NewRequest(item.Method, url, reqBody)
 			if errNewReq != nil {
 				panic(errNewReq)
 			}